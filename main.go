@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/blacklee123/feishu-kimi/pkg/api"
 	"github.com/blacklee123/feishu-kimi/pkg/version"
@@ -24,9 +25,30 @@ func main() {
 	fs.String("FEISHU_ENCRYPT_KEY", "", "FEISHU_ENCRYPT_KEY")
 	fs.String("FEISHU_VERIFICATION_TOKEN", "", "FEISHU_VERIFICATION_TOKEN")
 	fs.String("OPENAI_MODEL", "", "OPENAI_MODEL")
-	fs.String("OPENAI_KEY", "", "OPENAI_KEY")
+	fs.String("OPENAI_KEY", "", "OPENAI_KEY, separate multiple keys with commas")
+	fs.String("OPENAI_KEY_STRATEGY", "round_robin", "OPENAI_KEY_STRATEGY round_robin or least_limited")
+	fs.Duration("OPENAI_KEY_COOLDOWN", time.Minute, "OPENAI_KEY_COOLDOWN")
+	fs.Int("OPENAI_MAX_ATTEMPTS", 3, "OPENAI_MAX_ATTEMPTS including the first request, 1 to disable retry")
+	fs.Duration("OPENAI_RETRY_BASE_DELAY", 500*time.Millisecond, "OPENAI_RETRY_BASE_DELAY")
+	fs.Duration("OPENAI_RETRY_MAX_DELAY", 10*time.Second, "OPENAI_RETRY_MAX_DELAY")
 	fs.Int("OPENAI_MAX_TOKENS", 2000, "OPENAI_MAX_TOKENS")
 	fs.String("OPENAI_API_URL", "https://api.openai.com/v1", "OPENAI_API_URL")
+	fs.String("SESSION_STORE", "memory", "SESSION_STORE memory, bolt or redis")
+	fs.String("SESSION_STORE_PATH", "data/sessions.db", "SESSION_STORE_PATH")
+	fs.String("REDIS_ADDR", "127.0.0.1:6379", "REDIS_ADDR")
+	fs.String("REDIS_PASSWORD", "", "REDIS_PASSWORD")
+	fs.Int("REDIS_DB", 0, "REDIS_DB")
+	fs.Int("HTTP_PORT", 9000, "HTTP_PORT for card callback")
+	fs.String("ADMIN_TOKEN", "", "ADMIN_TOKEN for admin api, empty to disable")
+	fs.Duration("SESSION_LIFETIME_P2P", time.Hour*12, "SESSION_LIFETIME_P2P")
+	fs.Duration("SESSION_IDLE_P2P", time.Hour*12, "SESSION_IDLE_P2P")
+	fs.Duration("SESSION_LIFETIME_GROUP", time.Hour*12, "SESSION_LIFETIME_GROUP")
+	fs.Duration("SESSION_IDLE_GROUP", time.Hour*12, "SESSION_IDLE_GROUP")
+	fs.String("ROLE_LIST_PATH", "config/roles.yaml", "ROLE_LIST_PATH")
+	fs.String("SYSTEM_PROMPT", "", "SYSTEM_PROMPT template, empty for default")
+	fs.String("TIMEZONE", "Asia/Shanghai", "TIMEZONE")
+	fs.StringSlice("MODEL_FALLBACK", nil, "MODEL_FALLBACK profile names")
+	fs.StringSlice("TOOLS", []string{"calculator", "current_time", "lookup_feishu_user"}, "TOOLS built-in tools the model can call, none to disable")
 
 	fs.String("config-path", "config", "config dir path")
 	fs.String("config", "config.yaml", "apiserver config file path")
@@ -65,13 +87,11 @@ func main() {
 	defer stdLog()
 
 	var config api.Config
-	// 打印当前从viper读取到的所有配置
-	log.Printf("Current Viper settings: %v\n", viper.AllSettings())
 	if err := viper.Unmarshal(&config); err != nil {
 		log.Panic("config unmarshal failed", err)
 	}
-	// 绑定设置到config结构体并确保值都成功加载
-	log.Printf("Unmarshaled configuration: %+v\n", config)
+	// 绑定设置到config结构体并确保值都成功加载，密钥只打印掩码
+	log.Printf("Unmarshaled configuration: %+v\n", config.Redacted())
 	srv, err := api.NewServer(&config, logger)
 	if err != nil {
 		logger.Fatal("初始化失败", zap.Error(err))
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	larkcard "github.com/larksuite/oapi-sdk-go/v3/card"
+)
+
+func NewAIModeCardHandler(cardMsg CardMsg, m MessageHandler) CardHandlerFunc {
+	return func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
+		if cardMsg.Kind == AIModeChooseKind {
+			return nil, CommonProcessAIMode(ctx, cardMsg, cardAction, m)
+		}
+		return nil, ErrNextHandler
+	}
+}
+
+func CommonProcessAIMode(ctx context.Context, cardMsg CardMsg, cardAction *larkcard.CardAction, m MessageHandler) error {
+	option := cardAction.Action.Option
+	m.withSessionLock(cardMsg, cardAction, func(ctx context.Context, a *ActionInfo) {
+		if err := m.setAIMode(cardMsg.SessionId, option); err != nil {
+			a.replyMsg(ctx, fmt.Sprintf("🤖️：切换模式失败\n错误信息: %v", err), &cardMsg.MsgId)
+			return
+		}
+		a.replyMsg(ctx, aiModeChangedMsg(option), &cardMsg.MsgId)
+	})
+	return nil
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"context"
+
+	"github.com/blacklee123/feishu-kimi/pkg/services"
+	larkcard "github.com/larksuite/oapi-sdk-go/v3/card"
+	openai "github.com/sashabaranov/go-openai"
+	"go.uber.org/zap"
+)
+
+func NewAnswerCardHandler(cardMsg CardMsg, m MessageHandler) CardHandlerFunc {
+	return func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
+		if cardMsg.Kind == AnswerKind {
+			// 生成回答耗时较长，卡片回调需要立即返回
+			go CommonProcessAnswer(cardMsg, cardAction, m)
+			return nil, nil
+		}
+		return nil, ErrNextHandler
+	}
+}
+
+// CommonProcessAnswer 处理回答卡片上的重新生成、继续生成、复制和新话题，
+// 继续生成会追加到原来的回答中，不会新增一轮对话
+func CommonProcessAnswer(cardMsg CardMsg, cardAction *larkcard.CardAction, m MessageHandler) {
+	ctx := context.Background()
+	a := m.newCardActionInfo(&ctx, cardMsg, cardAction)
+	action, _ := cardMsg.Value.(string)
+	if action == AnswerNewTopic {
+		newSessionId, err := a.sendNewTopicCardWithBackId(ctx, a.info.chatId)
+		if err != nil {
+			m.logger.Error("sendNewTopicCard error", zap.Error(err))
+			return
+		}
+		if chatType := m.sessionCache.GetChatType(cardMsg.SessionId); chatType != "" {
+			m.sessionCache.SetChatType(*newSessionId, chatType)
+		}
+		return
+	}
+
+	unlock, err := m.sessionCache.Lock(cardMsg.SessionId)
+	if err != nil {
+		a.replyMsg(ctx, "🤖️：当前话题正在处理中，请稍后再试～", a.info.msgId)
+		return
+	}
+	defer unlock()
+
+	msg := m.sessionCache.GetMsg(cardMsg.SessionId)
+	if cardMsg.MsgIndex <= 0 || cardMsg.MsgIndex >= len(msg) ||
+		msg[cardMsg.MsgIndex].Role != openai.ChatMessageRoleAssistant {
+		a.replyMsg(ctx, "🤖️：该回答已不在当前话题中，可能话题已过期或已被撤销", a.info.msgId)
+		return
+	}
+	switch action {
+	case AnswerCopy:
+		a.replyMsg(ctx, msg[cardMsg.MsgIndex].Content, a.info.msgId)
+	case AnswerRegenerate, AnswerContinue:
+		if cardMsg.MsgIndex != len(msg)-1 {
+			a.replyMsg(ctx, "🤖️：只能对话题中最新的回答进行该操作", a.info.msgId)
+			return
+		}
+		settings := m.sessionCache.GetSettings(cardMsg.SessionId)
+		if action == AnswerRegenerate {
+			a.regenerate(settings)
+			return
+		}
+		a.continueAnswer(msg, settings)
+	}
+}
+
+// continuePrompt 继续生成时附加的提问，不写入会话
+const continuePrompt = "请从上次中断的地方继续输出，不要重复已经输出的内容。"
+
+// continueAnswer 请求模型接着最后一个回答继续输出，结果追加到同一个回答和卡片中
+func (a *ActionInfo) continueAnswer(msg []openai.ChatCompletionMessage, settings services.SessionSettings) {
+	index := len(msg) - 1
+	prefix := msg[index].Content
+	newTopic := isFirstAnswer(msg, index)
+	request, history, summary := a.compactContext(append(msg, openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleUser,
+		Content: continuePrompt,
+		Name:    *a.info.userId,
+	}), settings)
+	// 最后一条消息始终保留，去掉不写入会话的继续生成提问
+	history = history[:len(history)-1]
+	if len(history) == 0 || history[len(history)-1].Role != openai.ChatMessageRoleAssistant {
+		a.replyMsg(*a.ctx, "🤖️：上下文过长，无法继续生成，可以开启新的话题", a.info.msgId)
+		return
+	}
+	answer, finishReason, err := a.streamToCard(settings.WithModePrompt(services.WithSummary(request, summary)), settings, nil, prefix, newTopic)
+	if err != nil {
+		a.logger.Error("StreamChat error", zap.Error(err))
+		// 恢复为继续生成之前的回答
+		if err := a.updateAnswerCard(*a.ctx, prefix, a.info.cardId, newTopic, index, openai.FinishReasonLength); err != nil {
+			a.logger.Error("updateAnswerCard error", zap.Error(err))
+		}
+		a.replyMsg(*a.ctx, "🤖️：继续生成失败，请稍后再试～", a.info.msgId)
+		return
+	}
+	history[len(history)-1].Content = prefix + answer
+	if err := a.updateAnswerCard(*a.ctx, prefix+answer, a.info.cardId, newTopic, len(history)-1, finishReason); err != nil {
+		a.logger.Error("updateAnswerCard error", zap.Error(err))
+		return
+	}
+	a.handler.sessionCache.SetMsg(*a.info.sessionId, history)
+	a.recordHistory(history)
+}
+
+// isFirstAnswer 第 index 条消息是否为话题中第一个提问的回答
+func isFirstAnswer(msg []openai.ChatCompletionMessage, index int) bool {
+	users := 0
+	for _, m := range msg[:index] {
+		if m.Role == openai.ChatMessageRoleUser {
+			users++
+		}
+	}
+	return users <= 1
+}
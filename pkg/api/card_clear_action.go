@@ -0,0 +1,51 @@
+package api
+
+import (
+	"context"
+
+	"github.com/blacklee123/feishu-kimi/pkg/services"
+	larkcard "github.com/larksuite/oapi-sdk-go/v3/card"
+	"go.uber.org/zap"
+)
+
+func NewClearCardHandler(cardMsg CardMsg, m MessageHandler) CardHandlerFunc {
+	return func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
+		if cardMsg.Kind == ClearCardKind {
+			newCard, err, done := CommonProcessClearCache(cardMsg, cardAction, m)
+			if done {
+				return newCard, err
+			}
+			return nil, nil
+		}
+		return nil, ErrNextHandler
+	}
+}
+
+// CommonProcessClearCache 确认清除时等待正在生成的回答结束后再清除，完成后更新卡片
+func CommonProcessClearCache(cardMsg CardMsg, cardAction *larkcard.CardAction, m MessageHandler) (interface{}, error, bool) {
+	if cardMsg.Value == "1" {
+		m.withSessionLock(cardMsg, cardAction, func(ctx context.Context, a *ActionInfo) {
+			// 保留空的会话，之后在话题内回复时作为新话题而不是提示上下文已过期
+			m.startSession(cardMsg.SessionId, services.SessionSettings{})
+			m.logger.Info("[clear]", zap.String("sessionId", cardMsg.SessionId))
+			newCard, _ := newSendCard(
+				withHeader("️🆑 机器人提醒", larkcard.TemplateGrey),
+				withMainMd("已删除此话题的上下文信息"),
+				withNote("我们可以开始一个全新的话题，继续找我聊天吧"),
+			)
+			if err := a.PatchCard(ctx, &cardAction.OpenMessageID, newCard); err != nil {
+				m.logger.Error("PatchCard error", zap.Error(err))
+			}
+		})
+		return nil, nil, true
+	}
+	if cardMsg.Value == "0" {
+		newCard, _ := newSendCard(
+			withHeader("️🆑 机器人提醒", larkcard.TemplateGreen),
+			withMainMd("依旧保留此话题的上下文信息"),
+			withNote("我们可以继续探讨这个话题，期待和您聊天。如果您有其他问题或者想要讨论的话题，请告诉我哦"),
+		)
+		return newCard, nil, true
+	}
+	return nil, nil, false
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	larkcard "github.com/larksuite/oapi-sdk-go/v3/card"
+	larkevent "github.com/larksuite/oapi-sdk-go/v3/event"
+	"go.uber.org/zap"
+)
+
+type CardHandlerMeta func(cardMsg CardMsg, m MessageHandler) CardHandlerFunc
+
+type CardHandlerFunc func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error)
+
+var ErrNextHandler = fmt.Errorf("next handler")
+
+// NewCardHandler 卡片回调的分发入口，将按钮的 value 解析为 CardMsg 后按 Kind 依次交给各 handler，
+// 通过 /webhook/card 接收回调；暂未支持的类型由 NewUnsupportedCardHandler 统一回复
+func NewCardHandler(m MessageHandler) CardHandlerFunc {
+	handlers := []CardHandlerMeta{
+		NewSettingsCardHandler,
+		NewHistoryCardHandler,
+		NewAnswerCardHandler,
+		NewClearCardHandler,
+		NewRoleTagCardHandler,
+		NewRoleCardHandler,
+		NewAIModeCardHandler,
+		NewUnsupportedCardHandler,
+	}
+
+	return func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
+		var cardMsg CardMsg
+		actionValue := cardAction.Action.Value
+		actionValueJson, _ := json.Marshal(actionValue)
+		if err := json.Unmarshal(actionValueJson, &cardMsg); err != nil {
+			return nil, err
+		}
+		m.logger.Info("[card]", zap.String("kind", string(cardMsg.Kind)), zap.String("sessionId", cardMsg.SessionId), zap.String("openId", cardAction.OpenID))
+		for _, handler := range handlers {
+			h := handler(cardMsg, m)
+			i, err := h(ctx, cardAction)
+			if err == ErrNextHandler {
+				continue
+			}
+			return i, err
+		}
+		m.logger.Warn("[card] unknown kind", zap.String("kind", string(cardMsg.Kind)))
+		return nil, nil
+	}
+}
+
+// 已有按钮但暂未支持的卡片类型
+var unsupportedCardKinds = map[CardKind]bool{
+	PicModeChangeKind:    true,
+	VisionModeChangeKind: true,
+	PicResolutionKind:    true,
+	PicStyleKind:         true,
+	VisionStyleKind:      true,
+	PicTextMoreKind:      true,
+	PicVarMoreKind:       true,
+}
+
+func NewUnsupportedCardHandler(cardMsg CardMsg, m MessageHandler) CardHandlerFunc {
+	return func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
+		if unsupportedCardKinds[cardMsg.Kind] {
+			a := m.newCardActionInfo(&ctx, cardMsg, cardAction)
+			return nil, a.replyMsg(ctx, "🤖️：暂不支持该操作", a.info.msgId)
+		}
+		return nil, ErrNextHandler
+	}
+}
+
+// withSessionLock 在后台锁定会话后执行 fn，避免与正在生成的回答同时修改会话。
+// 卡片回调需要立即返回，fn 执行完后通过更新卡片或回复消息告知结果
+func (m MessageHandler) withSessionLock(cardMsg CardMsg, cardAction *larkcard.CardAction, fn func(ctx context.Context, a *ActionInfo)) {
+	go func() {
+		ctx := context.Background()
+		a := m.newCardActionInfo(&ctx, cardMsg, cardAction)
+		unlock, err := m.sessionCache.Lock(cardMsg.SessionId)
+		if err != nil {
+			m.logger.Error("lock session error", zap.String("sessionId", cardMsg.SessionId), zap.Error(err))
+			a.replyMsg(ctx, "🤖️：当前话题正在处理中，请稍后再试～", a.info.msgId)
+			return
+		}
+		defer unlock()
+		fn(ctx, a)
+	}()
+}
+
+// newCardActionInfo 为卡片回调构造 ActionInfo，复用消息处理中的发送方法
+func (m MessageHandler) newCardActionInfo(ctx *context.Context, cardMsg CardMsg, cardAction *larkcard.CardAction) *ActionInfo {
+	msgInfo := MsgInfo{
+		msgId:     &cardAction.OpenMessageID,
+		chatId:    &cardAction.OpenChatId,
+		userId:    &cardAction.OpenID,
+		sessionId: &cardMsg.SessionId,
+		cardId:    &cardAction.OpenMessageID,
+	}
+	return &ActionInfo{
+		ctx:        ctx,
+		handler:    &m,
+		info:       &msgInfo,
+		logger:     m.logger,
+		config:     m.config,
+		larkClient: m.larkClient,
+	}
+}
+
+// cardFormValue 解析表单提交的 form_value，SDK 的 CardAction 中没有该字段
+func (m MessageHandler) cardFormValue(cardAction *larkcard.CardAction) (map[string]interface{}, error) {
+	body := cardAction.EventReq.Body
+	var encrypt larkevent.EventEncryptMsg
+	if err := json.Unmarshal(body, &encrypt); err != nil {
+		return nil, err
+	}
+	if encrypt.Encrypt != "" {
+		plain, err := larkevent.EventDecrypt(encrypt.Encrypt, m.config.FeishuEncryptKey)
+		if err != nil {
+			return nil, err
+		}
+		body = plain
+	}
+	var formAction struct {
+		Action struct {
+			FormValue map[string]interface{} `json:"form_value"`
+		} `json:"action"`
+	}
+	if err := json.Unmarshal(body, &formAction); err != nil {
+		return nil, err
+	}
+	return formAction.Action.FormValue, nil
+}
+
+func formString(form map[string]interface{}, key string) string {
+	if v, ok := form[key].(string); ok {
+		return v
+	}
+	return ""
+}
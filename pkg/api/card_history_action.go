@@ -0,0 +1,31 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	larkcard "github.com/larksuite/oapi-sdk-go/v3/card"
+)
+
+func NewHistoryCardHandler(cardMsg CardMsg, m MessageHandler) CardHandlerFunc {
+	return func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
+		if cardMsg.Kind == HistoryKind {
+			return nil, CommonProcessHistory(ctx, cardMsg, cardAction, m)
+		}
+		return nil, ErrNextHandler
+	}
+}
+
+// CommonProcessHistory 在原话题内回复，方便用户继续对话
+func CommonProcessHistory(ctx context.Context, cardMsg CardMsg, cardAction *larkcard.CardAction, m MessageHandler) error {
+	a := m.newCardActionInfo(&ctx, cardMsg, cardAction)
+	if !m.sessionCache.Exists(cardMsg.SessionId) {
+		return a.replyMsg(ctx, "🤖️：该话题已过期，无法继续", &cardAction.OpenMessageID)
+	}
+	question, _ := cardMsg.Value.(string)
+	newCard, _ := newSendCard(
+		withHeader("🔃️ 继续之前的话题", larkcard.TemplateBlue),
+		withMainMd(fmt.Sprintf("**%s**", question)),
+		withNote("提醒：在此回复即可基于之前的上下文继续对话"))
+	return a.replyCard(ctx, &cardMsg.SessionId, newCard)
+}
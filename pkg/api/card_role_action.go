@@ -0,0 +1,54 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	larkcard "github.com/larksuite/oapi-sdk-go/v3/card"
+	"go.uber.org/zap"
+)
+
+func NewRoleTagCardHandler(cardMsg CardMsg, m MessageHandler) CardHandlerFunc {
+	return func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
+		if cardMsg.Kind == RoleTagsChooseKind {
+			return nil, CommonProcessRoleTag(ctx, cardMsg, cardAction, m)
+		}
+		return nil, ErrNextHandler
+	}
+}
+
+func NewRoleCardHandler(cardMsg CardMsg, m MessageHandler) CardHandlerFunc {
+	return func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
+		if cardMsg.Kind == RoleChooseKind {
+			return nil, CommonProcessRole(ctx, cardMsg, cardAction, m)
+		}
+		return nil, ErrNextHandler
+	}
+}
+
+func CommonProcessRoleTag(ctx context.Context, cardMsg CardMsg, cardAction *larkcard.CardAction, m MessageHandler) error {
+	option := cardAction.Action.Option
+	a := m.newCardActionInfo(&ctx, cardMsg, cardAction)
+	a.SendRoleListCard(ctx, &cardMsg.SessionId, &cardMsg.MsgId, option, m.roles.TitlesByTag(option))
+	return nil
+}
+
+// CommonProcessRole 使用选中角色的提示词开启新的话题
+func CommonProcessRole(ctx context.Context, cardMsg CardMsg, cardAction *larkcard.CardAction, m MessageHandler) error {
+	option := cardAction.Action.Option
+	role, ok := m.roles.RoleByTitle(option)
+	if !ok {
+		return fmt.Errorf("role %q not found", option)
+	}
+	settings, err := role.Settings()
+	if err != nil {
+		return err
+	}
+	m.withSessionLock(cardMsg, cardAction, func(ctx context.Context, a *ActionInfo) {
+		m.startSession(cardMsg.SessionId, settings)
+		m.logger.Info("[role]", zap.String("sessionId", cardMsg.SessionId), zap.String("role", role.Title))
+		a.sendSystemInstructionCard(ctx, &cardMsg.SessionId, &cardMsg.MsgId,
+			fmt.Sprintf("%s\n\n%s", role.Title, role.Prompt))
+	})
+	return nil
+}
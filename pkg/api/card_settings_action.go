@@ -0,0 +1,78 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/blacklee123/feishu-kimi/pkg/services"
+	larkcard "github.com/larksuite/oapi-sdk-go/v3/card"
+	openai "github.com/sashabaranov/go-openai"
+	"go.uber.org/zap"
+)
+
+func NewSettingsCardHandler(cardMsg CardMsg, m MessageHandler) CardHandlerFunc {
+	return func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
+		if cardMsg.Kind == SettingsKind {
+			form, err := m.cardFormValue(cardAction)
+			if err != nil {
+				return nil, err
+			}
+			return CommonProcessSettings(ctx, cardMsg, cardAction, form, m)
+		}
+		return nil, ErrNextHandler
+	}
+}
+
+// CommonProcessSettings 加锁保存设置表单，完成后将卡片更新为保存后的设置
+func CommonProcessSettings(ctx context.Context, cardMsg CardMsg, cardAction *larkcard.CardAction,
+	form map[string]interface{}, m MessageHandler) (interface{}, error) {
+	m.withSessionLock(cardMsg, cardAction, func(ctx context.Context, a *ActionInfo) {
+		newCard, err := applySettingsForm(a, cardMsg, form, m)
+		if err != nil {
+			m.logger.Error("settings card error", zap.Error(err))
+			return
+		}
+		if err := a.PatchCard(ctx, &cardAction.OpenMessageID, newCard); err != nil {
+			m.logger.Error("PatchCard error", zap.Error(err))
+		}
+	})
+	return nil, nil
+}
+
+// applySettingsForm 保存设置表单，并返回更新后的设置卡片
+func applySettingsForm(a *ActionInfo, cardMsg CardMsg, form map[string]interface{}, m MessageHandler) (string, error) {
+	settings := m.sessionCache.GetSettings(cardMsg.SessionId)
+
+	msgId := cardMsg.MsgId
+	if model := formString(form, "model"); model != "" && model != a.llm().ModelOf(settings) {
+		current := settings
+		err := settings.Set("model", model)
+		if err == nil {
+			err = services.CheckSettings(a.llm(), settings)
+		}
+		if err != nil {
+			return a.newSettingsCard(&cardMsg.SessionId, &msgId, current, fmt.Sprintf("❌ 设置失败：%v", err))
+		}
+	}
+	// 表单总会提交当前的选择，只有修改时才设置，避免取消 /mode 选择的预设
+	if creativity := formString(form, "creativity"); creativity != "" && creativity != settings.Creativity() {
+		if err := settings.SetCreativity(creativity); err != nil {
+			return a.newSettingsCard(&cardMsg.SessionId, &msgId, settings, fmt.Sprintf("❌ 设置失败：%v", err))
+		}
+	}
+	if systemPrompt := strings.TrimSpace(formString(form, "system_prompt")); systemPrompt != settings.SystemPrompt {
+		settings.SystemPrompt = systemPrompt
+		// 已有对话时替换其中的系统提示词，清空时恢复为默认的系统提示词
+		msg := m.sessionCache.GetMsg(cardMsg.SessionId)
+		if len(msg) > 0 && msg[0].Role == openai.ChatMessageRoleSystem {
+			if systemPrompt == "" {
+				systemPrompt = a.renderSystemPrompt()
+			}
+			msg[0].Content = systemPrompt
+			m.sessionCache.SetMsg(cardMsg.SessionId, msg)
+		}
+	}
+	m.sessionCache.SetSettings(cardMsg.SessionId, settings)
+	return a.newSettingsCard(&cardMsg.SessionId, &msgId, settings, "✅ 设置已保存，在本话题内回复即可生效")
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/blacklee123/feishu-kimi/pkg/services"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestApplySettingsFormClearSystemPrompt(t *testing.T) {
+	a, _ := newTestActionInfo(t, services.NewFakeProvider(), "")
+	prompts, err := services.NewPromptTemplates("默认提示词", nil, "Asia/Shanghai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.handler.prompts = prompts
+	sessionId := *a.info.sessionId
+	a.handler.sessionCache.SetSettings(sessionId, services.SessionSettings{SystemPrompt: "自定义提示词"})
+	a.handler.sessionCache.SetMsg(sessionId, []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: "自定义提示词"},
+		{Role: openai.ChatMessageRoleUser, Content: "你好"},
+	})
+
+	cardMsg := CardMsg{Kind: SettingsKind, SessionId: sessionId, MsgId: *a.info.msgId}
+	if _, err := applySettingsForm(a, cardMsg, map[string]interface{}{"system_prompt": ""}, *a.handler); err != nil {
+		t.Fatal(err)
+	}
+	if settings := a.handler.sessionCache.GetSettings(sessionId); settings.SystemPrompt != "" {
+		t.Errorf("SystemPrompt = %q, want empty", settings.SystemPrompt)
+	}
+	// 清空后对话中的系统提示词恢复为默认
+	if msg := a.handler.sessionCache.GetMsg(sessionId); msg[0].Content != "默认提示词" {
+		t.Errorf("system message = %q, want the default prompt", msg[0].Content)
+	}
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/blacklee123/feishu-kimi/pkg/services"
+	"github.com/blacklee123/feishu-kimi/pkg/utils"
+)
+
+type AIModeAction struct { /*回答模式*/
+}
+
+func (*AIModeAction) Execute(a *ActionInfo) bool {
+	if _, foundMode := utils.EitherTrimEqual(a.info.qParsed, "/mode", "模式"); foundMode {
+		a.SendAIModeListsCard(*a.ctx, a.info.sessionId, a.info.msgId, services.AIModeLabels())
+		return false
+	}
+	if label, foundMode := utils.EitherCutPrefix(a.info.qParsed, "/mode ", "模式 "); foundMode {
+		if err := a.handler.setAIMode(*a.info.sessionId, strings.TrimSpace(label)); err != nil {
+			a.replyMsg(*a.ctx, fmt.Sprintf("🤖️：切换模式失败\n错误信息: %v", err), a.info.msgId)
+			return false
+		}
+		a.replyMsg(*a.ctx, aiModeChangedMsg(strings.TrimSpace(label)), a.info.msgId)
+		return false
+	}
+	return true
+}
+
+// setAIMode 切换话题的回答模式，之后的回答都会使用该模式
+func (m MessageHandler) setAIMode(sessionId string, label string) error {
+	settings := m.sessionCache.GetSettings(sessionId)
+	if err := settings.SetMode(label); err != nil {
+		return err
+	}
+	m.sessionCache.SetSettings(sessionId, settings)
+	return nil
+}
+
+func aiModeChangedMsg(label string) string {
+	return fmt.Sprintf("🤖️：已切换为「%s」模式，在本话题内回复即可生效", label)
+}
@@ -0,0 +1,18 @@
+package api
+
+import "github.com/blacklee123/feishu-kimi/pkg/utils"
+
+type ClearAction struct { /*清除上下文*/
+}
+
+func (*ClearAction) Execute(a *ActionInfo) bool {
+	if _, foundClear := utils.EitherTrimEqual(a.info.qParsed, "/clear", "清除"); foundClear {
+		if len(a.handler.sessionCache.GetMsg(*a.info.sessionId)) == 0 {
+			a.replyMsg(*a.ctx, "🤖️：当前话题没有需要清除的上下文", a.info.msgId)
+			return false
+		}
+		a.sendClearCacheCheckCard(*a.ctx, a.info.sessionId, a.info.msgId)
+		return false
+	}
+	return true
+}
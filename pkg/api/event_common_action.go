@@ -3,12 +3,14 @@ package api
 import (
 	"context"
 
+	"github.com/blacklee123/feishu-kimi/pkg/services"
 	lark "github.com/larksuite/oapi-sdk-go/v3"
 	"go.uber.org/zap"
 )
 
 type MsgInfo struct {
 	newTopic    bool
+	expired     bool // 之前的上下文已过期
 	cardId      *string
 	handlerType HandlerType
 	msgType     string
@@ -33,3 +35,25 @@ type ActionInfo struct {
 type Action interface {
 	Execute(a *ActionInfo) bool
 }
+
+// startSession 清除话题并使用新的设置重新开始，会话类型保持不变
+func (m MessageHandler) startSession(sessionId string, settings services.SessionSettings) {
+	chatType := m.sessionCache.GetChatType(sessionId)
+	m.sessionCache.Clear(sessionId)
+	if chatType != "" {
+		m.sessionCache.SetChatType(sessionId, chatType)
+	}
+	m.sessionCache.SetSettings(sessionId, settings)
+}
+
+// llm 按会话的路由规则选择模型
+func (a *ActionInfo) llm() services.LLMProvider {
+	if a.handler.router == nil {
+		return a.handler.gpt
+	}
+	return a.handler.router.Route(services.Route{
+		ChatId:   *a.info.chatId,
+		UserId:   *a.info.userId,
+		ChatType: a.handler.sessionCache.GetChatType(*a.info.sessionId),
+	})
+}
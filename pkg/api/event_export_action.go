@@ -0,0 +1,75 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/blacklee123/feishu-kimi/pkg/services"
+	"github.com/blacklee123/feishu-kimi/pkg/utils"
+	openai "github.com/sashabaranov/go-openai"
+	"go.uber.org/zap"
+)
+
+type ExportAction struct { /*导出对话*/
+}
+
+func (*ExportAction) Execute(a *ActionInfo) bool {
+	matched, format := utils.MatchExport(a.info.qParsed)
+	if !matched {
+		return true
+	}
+	msg := a.handler.sessionCache.GetMsg(*a.info.sessionId)
+	if len(msg) == 0 {
+		a.replyMsg(*a.ctx, "🤖️：当前话题没有可导出的对话，请在话题内回复 /export", a.info.msgId)
+		return false
+	}
+
+	summary := a.handler.sessionCache.GetSummary(*a.info.sessionId)
+	transcript := services.NewTranscript(*a.info.sessionId, msg, summary, a.displayNames(msg))
+	var content []byte
+	switch format {
+	case "json":
+		b, err := transcript.JSON()
+		if err != nil {
+			a.logger.Error("marshal transcript error", zap.Error(err))
+			return false
+		}
+		content = b
+	default:
+		content = []byte(transcript.Markdown())
+	}
+
+	fileName := fmt.Sprintf("kimi-%s.%s", time.Now().Format("20060102-150405"), format)
+	fileKey, err := a.uploadFile(bytes.NewReader(content), fileName)
+	if err != nil {
+		a.logger.Error("uploadFile error", zap.Error(err))
+		a.replyMsg(*a.ctx, fmt.Sprintf("🤖️：导出失败\n错误信息: %v", err), a.info.msgId)
+		return false
+	}
+	if err := a.replyFile(*a.ctx, fileKey, a.info.msgId); err != nil {
+		a.logger.Error("replyFile error", zap.Error(err))
+	}
+	return false
+}
+
+// displayNames 查询对话中用户的展示名
+func (a *ActionInfo) displayNames(msg []openai.ChatCompletionMessage) map[string]string {
+	names := map[string]string{}
+	for _, m := range msg {
+		if _, ok := names[m.Name]; ok || m.Name == "" {
+			continue
+		}
+		if m.Role != openai.ChatMessageRoleUser {
+			names[m.Name] = m.Name
+			continue
+		}
+		user, err := a.retrieveUserInfo(*a.ctx, m.Name)
+		if err != nil || user.Name == nil {
+			names[m.Name] = m.Name
+			continue
+		}
+		names[m.Name] = *user.Name
+	}
+	return names
+}
@@ -18,6 +18,10 @@ func (*FileAction) Execute(a *ActionInfo) bool {
 			fmt.Println(err)
 			return false
 		}
+		defer os.Remove(a.info.fileName)
+		if a.importTranscript() {
+			return false
+		}
 		file, err := a.handler.gpt.CreateFile(*a.ctx, a.info.fileName)
 		if err != nil {
 			a.sendMsg(*a.ctx, fmt.Sprintf("🤖️：文件上传失败\n错误信息: %v", err), a.info.msgId)
@@ -31,7 +35,6 @@ func (*FileAction) Execute(a *ActionInfo) bool {
 			a.logger.Error("updateFinalCard error", zap.Error(err))
 			return false
 		}
-		defer os.Remove(a.info.fileName)
 		return false
 	}
 	return true
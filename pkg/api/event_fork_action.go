@@ -0,0 +1,47 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/blacklee123/feishu-kimi/pkg/utils"
+	openai "github.com/sashabaranov/go-openai"
+	"go.uber.org/zap"
+)
+
+type ForkAction struct { /*分叉话题*/
+}
+
+func (*ForkAction) Execute(a *ActionInfo) bool {
+	if _, foundFork := utils.EitherTrimEqual(a.info.qParsed, "/fork", "分叉"); !foundFork {
+		return true
+	}
+	msg := a.handler.sessionCache.GetMsg(*a.info.sessionId)
+	if len(msg) == 0 {
+		a.replyMsg(*a.ctx, "🤖️：当前话题没有可以分叉的对话，请在话题内回复 /fork", a.info.msgId)
+		return false
+	}
+
+	newSessionId, err := a.sendForkCard(*a.ctx, a.info.chatId, forkContent(msg))
+	if err != nil {
+		a.logger.Error("sendForkCard error", zap.Error(err))
+		a.replyMsg(*a.ctx, fmt.Sprintf("🤖️：分叉失败\n错误信息: %v", err), a.info.msgId)
+		return false
+	}
+	if !a.handler.sessionCache.Fork(*a.info.sessionId, *newSessionId) {
+		a.replyMsg(*a.ctx, "🤖️：分叉失败，当前话题已过期", a.info.msgId)
+		return false
+	}
+	a.logger.Info("[fork]", zap.String("sessionId", *a.info.sessionId), zap.String("newSessionId", *newSessionId))
+	a.replyMsg(*a.ctx, "🤖️：已分叉出新的话题，两个话题之后的对话互不影响", a.info.msgId)
+	return false
+}
+
+// forkContent 展示分叉时最后一轮的问题
+func forkContent(msg []openai.ChatCompletionMessage) string {
+	for i := len(msg) - 1; i >= 0; i-- {
+		if msg[i].Role == openai.ChatMessageRoleUser {
+			return fmt.Sprintf("从以下问题处分叉，共 %d 条消息：\n**%s**", len(msg), truncateRunes(msg[i].Content, 100))
+		}
+	}
+	return fmt.Sprintf("共 %d 条消息", len(msg))
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/blacklee123/feishu-kimi/pkg/services"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestForkActionDiverge(t *testing.T) {
+	llm := services.NewFakeProvider()
+	a, lk := newTestActionInfo(t, llm, "/fork")
+	root := *a.info.sessionId
+	a.handler.sessionCache.SetMsg(root, []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: "system", Name: "Kimi"},
+		{Role: openai.ChatMessageRoleUser, Content: "共同的问题", Name: "ou_1"},
+		{Role: openai.ChatMessageRoleAssistant, Content: "共同的回答", Name: "Kimi"},
+	})
+
+	if (&ForkAction{}).Execute(a) {
+		t.Fatal("Execute() = true, want false")
+	}
+	if reply := lk.lastReply(); !strings.Contains(reply, "已分叉") {
+		t.Fatalf("reply = %s", reply)
+	}
+	// 分叉卡片是第一条发出的消息
+	forked := "om_sent_1"
+	if !a.handler.sessionCache.Exists(forked) {
+		t.Fatalf("forked session %s not found", forked)
+	}
+
+	// 分别在两个话题中继续对话
+	a.info.qParsed = "原话题的追问"
+	(&MessageAction{}).Execute(a)
+	a.info.sessionId = &forked
+	a.info.qParsed = "新话题的追问"
+	(&MessageAction{}).Execute(a)
+
+	contents := func(sessionId string) string {
+		var b strings.Builder
+		for _, m := range a.handler.sessionCache.GetMsg(sessionId) {
+			b.WriteString(m.Content + "\n")
+		}
+		return b.String()
+	}
+	rootMsg, forkedMsg := contents(root), contents(forked)
+	for _, want := range []string{"共同的问题", "共同的回答"} {
+		if !strings.Contains(rootMsg, want) || !strings.Contains(forkedMsg, want) {
+			t.Errorf("both sessions should keep %q:\n%s\n%s", want, rootMsg, forkedMsg)
+		}
+	}
+	if !strings.Contains(rootMsg, "原话题的追问") || strings.Contains(rootMsg, "新话题的追问") {
+		t.Errorf("root session = %s", rootMsg)
+	}
+	if !strings.Contains(forkedMsg, "新话题的追问") || strings.Contains(forkedMsg, "原话题的追问") {
+		t.Errorf("forked session = %s", forkedMsg)
+	}
+	// 新话题的请求中不包含原话题之后的对话
+	requests := llm.Requests()
+	if len(requests) != 2 || len(requests[1]) != 4 || requests[1][3].Content != "新话题的追问" {
+		t.Errorf("requests = %+v", requests)
+	}
+}
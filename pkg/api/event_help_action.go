@@ -55,6 +55,7 @@ func (*HelpAction) Execute(a *ActionInfo) bool {
 			a.logger.Error("GetFileContent error", zap.Error(err))
 			return false
 		}
+		defer file.Close()
 		msg, err := io.ReadAll(file)
 		if err != nil {
 			a.logger.Error("ReadAll error", zap.Error(err))
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"time"
+
+	"github.com/blacklee123/feishu-kimi/pkg/services"
+	"github.com/blacklee123/feishu-kimi/pkg/utils"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// /history 展示的话题数
+const historyListSize = 10
+
+type HistoryAction struct { /*历史话题*/
+}
+
+func (*HistoryAction) Execute(a *ActionInfo) bool {
+	if _, foundHistory := utils.EitherTrimEqual(a.info.qParsed, "/history", "历史"); foundHistory {
+		history := a.handler.sessionCache.GetHistory(*a.info.userId, *a.info.chatId)
+		if len(history) == 0 {
+			a.replyMsg(*a.ctx, "🤖️：暂时没有可以继续的话题", a.info.msgId)
+			return false
+		}
+		if len(history) > historyListSize {
+			history = history[:historyListSize]
+		}
+		a.sendHistoryCard(*a.ctx, a.info.msgId, history)
+		return false
+	}
+	return true
+}
+
+// recordHistory 将当前话题记录到用户的话题索引
+func (a *ActionInfo) recordHistory(msg []openai.ChatCompletionMessage) {
+	question := a.info.qParsed
+	count := 0
+	for _, m := range msg {
+		if m.Role == openai.ChatMessageRoleSystem {
+			continue
+		}
+		if count == 0 && m.Role == openai.ChatMessageRoleUser {
+			question = m.Content
+		}
+		count++
+	}
+	a.handler.sessionCache.RecordHistory(*a.info.userId, services.HistoryEntry{
+		SessionId:    *a.info.sessionId,
+		ChatId:       *a.info.chatId,
+		ChatType:     a.handler.sessionCache.GetChatType(*a.info.sessionId),
+		Question:     truncateRunes(question, 50),
+		LastActiveAt: time.Now(),
+		MessageCount: count,
+	})
+}
+
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "…"
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/blacklee123/feishu-kimi/pkg/services"
+	"github.com/blacklee123/feishu-kimi/pkg/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	// 对话记录文件的大小上限
+	maxTranscriptSize = 5 * 1024 * 1024
+	// 发送 /import 后等待对话记录文件的时间，超时后发送的文件按普通文件处理
+	importWaitExpiration = time.Minute * 5
+)
+
+type ImportAction struct { /*导入对话*/
+}
+
+func (*ImportAction) Execute(a *ActionInfo) bool {
+	if _, foundImport := utils.EitherTrimEqual(a.info.qParsed, "/import", "导入"); foundImport {
+		a.handler.sessionCache.SetFlag(importKey(a.info), importWaitExpiration)
+		a.replyMsg(*a.ctx, "🤖️：请在 5 分钟内直接发送通过 /export json 导出的对话记录文件，我会基于它开启新的话题", a.info.msgId)
+		return false
+	}
+	return true
+}
+
+// importKey 记录用户在当前会话中是否在等待导入
+func importKey(info *MsgInfo) string {
+	return fmt.Sprintf("import:%s:%s", *info.chatId, *info.userId)
+}
+
+// importTranscript 识别已下载的文件是否为对话记录，是则导入到新的话题。
+// 返回 false 表示不是对话记录，继续按普通文件上传。
+func (a *ActionInfo) importTranscript() bool {
+	key := importKey(a.info)
+	pending := a.handler.sessionCache.HasFlag(key)
+	if !pending && !strings.HasSuffix(strings.ToLower(a.info.fileName), ".json") {
+		return false
+	}
+
+	transcript, err := readTranscript(a.info.fileName)
+	if err != nil {
+		if !pending {
+			return false
+		}
+		a.handler.sessionCache.ClearFlag(key)
+		a.updateFinalCard(*a.ctx, fmt.Sprintf("🤖️：导入失败，文件不是有效的对话记录\n错误信息: %v", err), a.info.cardId, a.info.newTopic)
+		return true
+	}
+	a.handler.sessionCache.ClearFlag(key)
+
+	if !a.info.newTopic {
+		a.updateFinalCard(*a.ctx, "🤖️：导入失败，请在新的消息中发送对话记录文件，而不是在已有话题内回复", a.info.cardId, a.info.newTopic)
+		return true
+	}
+	a.handler.sessionCache.SetMsg(*a.info.sessionId, transcript.ChatMessages())
+	a.handler.sessionCache.SetSummary(*a.info.sessionId, transcript.Summary)
+	a.logger.Info("transcript imported", zap.String("sessionId", *a.info.sessionId), zap.Int("messages", len(transcript.Messages)))
+
+	msg := fmt.Sprintf("🤖️：对话记录导入成功\n共 %d 条消息，导出于 %s\n\n在本话题内回复即可继续对话", len(transcript.Messages), transcript.ExportedAt.Format(time.DateTime))
+	if err := a.updateFinalCard(*a.ctx, msg, a.info.cardId, a.info.newTopic); err != nil {
+		a.logger.Error("updateFinalCard error", zap.Error(err))
+	}
+	return true
+}
+
+func readTranscript(fileName string) (*services.Transcript, error) {
+	stat, err := os.Stat(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if stat.Size() > maxTranscriptSize {
+		return nil, fmt.Errorf("file too large: %d bytes", stat.Size())
+	}
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return services.ParseTranscript(data)
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"time"
 
+	"github.com/blacklee123/feishu-kimi/pkg/services"
 	"github.com/blacklee123/feishu-kimi/pkg/utils"
 	openai "github.com/sashabaranov/go-openai"
 	"go.uber.org/zap"
@@ -16,19 +17,16 @@ type MessageAction struct { /*消息*/
 
 func (*MessageAction) Execute(a *ActionInfo) bool {
 	msg := a.handler.sessionCache.GetMsg(*a.info.sessionId)
+	settings := a.handler.sessionCache.GetSettings(*a.info.sessionId)
 	if a.info.newTopic {
-		userName := ""
-		user, err := a.retrieveUserInfo(*a.ctx, *a.info.userId)
-		if err != nil {
-			userName = *a.info.userId
-		} else {
-			userName = *user.Name
+		systemPrompt := settings.SystemPrompt
+		if systemPrompt == "" {
+			systemPrompt = a.renderSystemPrompt()
 		}
 		msg = append(msg, openai.ChatCompletionMessage{
-			Role: openai.ChatMessageRoleSystem,
-			Content: fmt.Sprintf(`你是 Kimi，由 Moonshot AI 提供的人工智能助手，你更擅长中文和英文的对话。你会为用户提供安全，有帮助，准确的回答。同时，你会拒绝一切涉及恐怖主义，种族歧视，黄色暴力等问题的回答。Moonshot AI 为专有名词，不可翻译成其他语言。
-			我的名字是%s, 请使用这个名字和我交流。`, userName),
-			Name: "Kimi",
+			Role:    openai.ChatMessageRoleSystem,
+			Content: systemPrompt,
+			Name:    "Kimi",
 		})
 		if matched, fileId, prompt := utils.MatchReadFile(a.info.qParsed); matched {
 			file, err := a.handler.gpt.GetFileContent(*a.ctx, fileId)
@@ -36,6 +34,7 @@ func (*MessageAction) Execute(a *ActionInfo) bool {
 				a.logger.Error("GetFileContent error", zap.Error(err))
 				return false
 			}
+			defer file.Close()
 			fileContent, err := io.ReadAll(file)
 			if err != nil {
 				a.logger.Error("ReadAll error", zap.Error(err))
@@ -55,25 +54,77 @@ func (*MessageAction) Execute(a *ActionInfo) bool {
 		Content: a.info.qParsed,
 		Name:    *a.info.userId,
 	})
+	a.streamAnswer(msg, settings)
+	return false
+}
+
+// streamAnswer 流式请求回答并更新卡片，完成后将回答写入会话
+func (a *ActionInfo) streamAnswer(msg []openai.ChatCompletionMessage, settings services.SessionSettings) {
+	request, history, summary := a.compactContext(msg, settings)
+	answer, finishReason, err := a.streamToCard(settings.WithModePrompt(services.WithSummary(request, summary)), settings,
+		a.handler.tools, "", a.info.newTopic)
+	if err != nil {
+		a.logger.Error("StreamChat error", zap.Error(err))
+		if err := a.updateFinalCard(*a.ctx, "聊天失败", a.info.cardId, a.info.newTopic); err != nil {
+			a.logger.Error("updateFinalCard error", zap.Error(err))
+		}
+		return
+	}
+	history = append(history, openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleAssistant,
+		Content: answer,
+		Name:    history[0].Name,
+	})
+	if err := a.updateAnswerCard(*a.ctx, answer, a.info.cardId, a.info.newTopic, len(history)-1, finishReason); err != nil {
+		a.logger.Error("updateAnswerCard error", zap.Error(err))
+		return
+	}
+	a.handler.sessionCache.SetMsg(*a.info.sessionId, history)
+	a.recordHistory(history)
+}
+
+// compactContext 请求前按模型窗口裁剪上下文，为回答预留 max_tokens，被裁剪的轮次合并进摘要。
+// 返回请求使用的消息、需要写回会话的消息和摘要；摘要失败时只裁剪请求，会话中保留完整的消息
+func (a *ActionInfo) compactContext(msg []openai.ChatCompletionMessage, settings services.SessionSettings) (
+	request, history []openai.ChatCompletionMessage, summary string) {
+	summary = a.handler.sessionCache.GetSummary(*a.info.sessionId)
+	request, newSummary, err := services.CompactContext(*a.ctx, a.llm(), msg, summary, settings)
+	if err != nil {
+		a.logger.Error("Summarize error", zap.Error(err))
+		return request, msg, summary
+	}
+	if newSummary != summary {
+		a.logger.Info("context summarized", zap.Int("summaryLength", len([]rune(newSummary))))
+		a.handler.sessionCache.SetSummary(*a.info.sessionId, newSummary)
+	}
+	return request, request, newSummary
+}
+
+// streamToCard 流式请求回答，生成过程中将 prefix 加上已生成的内容更新到卡片上，
+// tools 不为空时模型可以调用其中的工具
+func (a *ActionInfo) streamToCard(msg []openai.ChatCompletionMessage, settings services.SessionSettings,
+	tools *services.ToolRegistry, prefix string, newTopic bool) (string, openai.FinishReason, error) {
 	answer := ""
 	chatResponseStream := make(chan string)
+	// StreamChat 结束时先关闭 chatResponseStream，结果随后写入 done
+	type streamResult struct {
+		finishReason openai.FinishReason
+		err          error
+	}
+	done := make(chan streamResult, 1)
+	ctx := context.WithValue(*a.ctx, toolUserKey{}, *a.info.userId)
 	go func() {
-		if err := a.handler.gpt.StreamChat(*a.ctx, msg, chatResponseStream); err != nil {
-			a.logger.Error("StreamChat error", zap.Error(err))
-			err := a.updateFinalCard(*a.ctx, "聊天失败", a.info.cardId, a.info.newTopic)
-			if err != nil {
-				a.logger.Error("updateFinalCard error", zap.Error(err))
-				return
-			}
-		}
+		finishReason, err := tools.StreamChat(ctx, a.llm(), msg, settings, chatResponseStream)
+		done <- streamResult{finishReason: finishReason, err: err}
 	}()
 	timer := time.NewTicker(700 * time.Millisecond)
+	defer timer.Stop()
 	for {
 		select {
 		case <-timer.C:
 			a.logger.Debug("answer", zap.String("answer", answer))
 			if answer != "" {
-				err := a.UpdateTextCard(*a.ctx, answer, a.info.cardId, a.info.newTopic)
+				err := a.UpdateTextCard(*a.ctx, prefix+answer, a.info.cardId, newTopic)
 				if err != nil {
 					a.logger.Error("UpdateTextCard error", zap.Error(err))
 				}
@@ -82,25 +133,42 @@ func (*MessageAction) Execute(a *ActionInfo) bool {
 		case res, ok := <-chatResponseStream:
 			if ok {
 				answer += res
-			} else {
-				timer.Stop()
-				err := a.updateFinalCard(*a.ctx, answer, a.info.cardId, a.info.newTopic)
-				if err != nil {
-					a.logger.Error("updateFinalCard error", zap.Error(err))
-					return false
-				}
-				msg := append(msg, openai.ChatCompletionMessage{
-					Role:    openai.ChatMessageRoleAssistant,
-					Content: answer,
-					Name:    msg[0].Name,
-				})
-				a.handler.sessionCache.SetMsg(*a.info.sessionId, msg)
-				return false
+				continue
 			}
-
+			result := <-done
+			a.logger.Info("answer finished", zap.String("finishReason", string(result.finishReason)),
+				zap.Int("answerLength", len([]rune(answer))))
+			return answer, result.finishReason, result.err
 		}
 	}
+}
 
+// renderSystemPrompt 使用当前会话配置的模板生成系统提示词
+func (a *ActionInfo) renderSystemPrompt() string {
+	prompts := a.handler.prompts
+	chatId := *a.info.chatId
+	vars := prompts.Vars(time.Now())
+	vars.UserName = *a.info.userId
+	user, err := a.retrieveUserInfo(*a.ctx, *a.info.userId)
+	if err == nil && user.Name != nil {
+		vars.UserName = *user.Name
+	}
+	// 部门和群名需要额外查询，仅在模板引用时获取
+	if prompts.Uses(chatId, "Department") && err == nil && len(user.DepartmentIds) > 0 {
+		if name, err := a.retrieveDepartmentName(*a.ctx, user.DepartmentIds[0]); err == nil {
+			vars.Department = name
+		}
+	}
+	if prompts.Uses(chatId, "ChatName") {
+		if name, err := a.retrieveChatName(*a.ctx, chatId); err == nil {
+			vars.ChatName = name
+		}
+	}
+	systemPrompt, err := prompts.Render(chatId, vars)
+	if err != nil {
+		a.logger.Error("render system prompt error", zap.Error(err))
+	}
+	return systemPrompt
 }
 
 func (a *ActionInfo) replyWithErrorMsg(ctx context.Context, err error, msgId *string) {
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/blacklee123/feishu-kimi/pkg/services"
+	lark "github.com/larksuite/oapi-sdk-go/v3"
+	larkcore "github.com/larksuite/oapi-sdk-go/v3/core"
+	openai "github.com/sashabaranov/go-openai"
+	"go.uber.org/zap"
+)
+
+// fakeLark 模拟飞书开放平台，记录更新卡片和回复的内容
+type fakeLark struct {
+	mu      sync.Mutex
+	patches []string
+	replies []string
+	nextId  int
+}
+
+func (f *fakeLark) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/tenant_access_token/internal"):
+		w.Write([]byte(`{"code":0,"msg":"ok","tenant_access_token":"t-test","expire":7200}`))
+	case r.Method == http.MethodPatch && strings.HasPrefix(r.URL.Path, "/open-apis/im/v1/messages/"):
+		body, _ := io.ReadAll(r.Body)
+		var req struct {
+			Content string `json:"content"`
+		}
+		json.Unmarshal(body, &req)
+		f.mu.Lock()
+		f.patches = append(f.patches, req.Content)
+		f.mu.Unlock()
+		w.Write([]byte(`{"code":0,"msg":"success","data":{}}`))
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/open-apis/im/v1/messages"):
+		// 发送和回复消息，返回新消息的 id
+		body, _ := io.ReadAll(r.Body)
+		var req struct {
+			Content string `json:"content"`
+		}
+		json.Unmarshal(body, &req)
+		f.mu.Lock()
+		f.nextId++
+		id := fmt.Sprintf("om_sent_%d", f.nextId)
+		if strings.HasSuffix(r.URL.Path, "/reply") {
+			f.replies = append(f.replies, req.Content)
+		}
+		f.mu.Unlock()
+		fmt.Fprintf(w, `{"code":0,"msg":"success","data":{"message_id":%q}}`, id)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"code":404,"msg":"not found"}`))
+	}
+}
+
+func (f *fakeLark) lastPatch() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.patches) == 0 {
+		return ""
+	}
+	return f.patches[len(f.patches)-1]
+}
+
+func (f *fakeLark) lastReply() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.replies) == 0 {
+		return ""
+	}
+	return f.replies[len(f.replies)-1]
+}
+
+// newTestActionInfo 使用 FakeProvider 和模拟的飞书接口构造一条话题内的回复
+func newTestActionInfo(t *testing.T, llm services.LLMProvider, question string) (*ActionInfo, *fakeLark) {
+	lk := &fakeLark{}
+	server := httptest.NewServer(lk)
+	t.Cleanup(server.Close)
+	larkClient := lark.NewClient("cli_test", "secret", lark.WithOpenBaseUrl(server.URL), lark.WithLogLevel(larkcore.LogLevelError))
+	handler := &MessageHandler{
+		sessionCache: services.InitSessionCache(services.NewMemoryStore(), nil),
+		gpt:          llm,
+		logger:       zap.NewNop(),
+		larkClient:   larkClient,
+	}
+	ctx := context.Background()
+	sessionId, msgId, cardId, userId, chatId := "om_root", "om_reply", "om_card", "ou_1", "oc_1"
+	return &ActionInfo{
+		handler: handler,
+		ctx:     &ctx,
+		info: &MsgInfo{
+			handlerType: UserHandler,
+			msgType:     "text",
+			msgId:       &msgId,
+			cardId:      &cardId,
+			userId:      &userId,
+			chatId:      &chatId,
+			sessionId:   &sessionId,
+			qParsed:     question,
+		},
+		logger:     handler.logger,
+		larkClient: larkClient,
+	}, lk
+}
+
+func TestMessageActionStreamAnswer(t *testing.T) {
+	llm := services.NewFakeProvider("你好，我是 Kimi")
+	a, lk := newTestActionInfo(t, llm, "你好")
+	a.handler.sessionCache.SetMsg(*a.info.sessionId, []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: "system", Name: "Kimi"},
+	})
+
+	if (&MessageAction{}).Execute(a) {
+		t.Fatal("Execute() = true, want false")
+	}
+	requests := llm.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("requests = %d, want 1", len(requests))
+	}
+	if last := requests[0][len(requests[0])-1]; last.Role != openai.ChatMessageRoleUser || last.Content != "你好" || last.Name != "ou_1" {
+		t.Errorf("request = %+v", requests[0])
+	}
+	msg := a.handler.sessionCache.GetMsg(*a.info.sessionId)
+	if len(msg) != 3 || msg[2].Role != openai.ChatMessageRoleAssistant || msg[2].Content != "你好，我是 Kimi" {
+		t.Errorf("session msg = %+v", msg)
+	}
+	if card := lk.lastPatch(); !strings.Contains(card, "你好，我是 Kimi") || !strings.Contains(card, "已完成") {
+		t.Errorf("answer card = %s", card)
+	}
+	if history := a.handler.sessionCache.GetHistory("ou_1", "oc_1"); len(history) != 1 || history[0].Question != "你好" {
+		t.Errorf("history = %+v", history)
+	}
+}
+
+func TestMessageActionStreamError(t *testing.T) {
+	llm := services.NewFakeProvider()
+	llm.Err = errors.New("service unavailable")
+	a, lk := newTestActionInfo(t, llm, "你好")
+	system := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleSystem, Content: "system", Name: "Kimi"}}
+	a.handler.sessionCache.SetMsg(*a.info.sessionId, system)
+
+	(&MessageAction{}).Execute(a)
+	if card := lk.lastPatch(); !strings.Contains(card, "聊天失败") {
+		t.Errorf("error card = %s", card)
+	}
+	// 请求失败时不保存本次提问
+	if msg := a.handler.sessionCache.GetMsg(*a.info.sessionId); len(msg) != 1 {
+		t.Errorf("session msg = %+v, want only the system message", msg)
+	}
+}
@@ -1,5 +1,7 @@
 package api
 
+import "github.com/blacklee123/feishu-kimi/pkg/services"
+
 type PreAction struct { /*图片*/
 }
 
@@ -15,11 +17,24 @@ func (*PreAction) Execute(a *ActionInfo) bool {
 		ifNewTopic = false
 	}
 
+	if ifNewTopic {
+		// 在话题内回复且会话曾经存在，说明之前的上下文已过期；
+		// 帮助、角色等卡片下的回复和机器人没见过的群消息没有会话，不算过期
+		isReply := *a.info.sessionId != *a.info.msgId
+		a.info.expired = isReply && a.handler.sessionCache.Expired(*a.info.sessionId)
+
+		chatType := services.ChatTypeP2P
+		if a.info.handlerType == GroupHandler {
+			chatType = services.ChatTypeGroup
+		}
+		a.handler.sessionCache.SetChatType(*a.info.sessionId, chatType)
+	}
+
+	a.info.newTopic = ifNewTopic
 	cardId, err := a.sendOnProcessCard(*a.ctx, a.info.sessionId, a.info.msgId, ifNewTopic)
 	if err != nil {
 		return false
 	}
 	a.info.cardId = cardId
-	a.info.newTopic = ifNewTopic
 	return true
 }
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/blacklee123/feishu-kimi/pkg/services"
+	"github.com/blacklee123/feishu-kimi/pkg/utils"
+)
+
+type RetryAction struct { /*重新生成*/
+}
+
+func (*RetryAction) Execute(a *ActionInfo) bool {
+	matched, temperature := utils.MatchRetry(a.info.qParsed)
+	if !matched {
+		return true
+	}
+	// 指定的 temperature 仅对本次生成生效
+	settings := a.handler.sessionCache.GetSettings(*a.info.sessionId)
+	if temperature != "" {
+		if err := settings.Set(services.SettingTemperature, temperature); err != nil {
+			a.replyMsg(*a.ctx, fmt.Sprintf("🤖️：重新生成失败\n错误信息: %v", err), a.info.msgId)
+			return false
+		}
+	}
+	if !a.regenerate(settings) {
+		a.replyMsg(*a.ctx, "🤖️：当前话题没有可以重新生成的回答，请在话题内回复 /retry", a.info.msgId)
+	}
+	return false
+}
+
+// regenerate 丢弃最后一个回答并重新生成，没有可重新生成的回答时返回 false
+func (a *ActionInfo) regenerate(settings services.SessionSettings) bool {
+	msg := a.handler.sessionCache.GetMsg(*a.info.sessionId)
+	i := lastUserIndex(msg)
+	if i < 0 {
+		return false
+	}
+	cardId, err := a.sendOnProcessCard(*a.ctx, a.info.sessionId, a.info.msgId, false)
+	if err != nil {
+		return true
+	}
+	a.info.cardId = cardId
+	a.info.qParsed = msg[i].Content
+	a.streamAnswer(msg[:i+1], settings)
+	return true
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/blacklee123/feishu-kimi/pkg/services"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// settingsProvider 记录每次请求使用的会话设置
+type settingsProvider struct {
+	*services.FakeProvider
+	mu       sync.Mutex
+	settings []services.SessionSettings
+}
+
+func (p *settingsProvider) StreamChat(ctx context.Context, msgs []openai.ChatCompletionMessage, settings services.SessionSettings, responseStream chan<- string) (openai.FinishReason, error) {
+	p.mu.Lock()
+	p.settings = append(p.settings, settings)
+	p.mu.Unlock()
+	return p.FakeProvider.StreamChat(ctx, msgs, settings, responseStream)
+}
+
+func TestRetryActionTemperature(t *testing.T) {
+	llm := &settingsProvider{FakeProvider: services.NewFakeProvider("新的回答")}
+	a, lk := newTestActionInfo(t, llm, "/retry 0.8")
+	sessionId := *a.info.sessionId
+	a.handler.sessionCache.SetMsg(sessionId, []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: "system", Name: "Kimi"},
+		{Role: openai.ChatMessageRoleUser, Content: "写一首诗", Name: "ou_1"},
+		{Role: openai.ChatMessageRoleAssistant, Content: "旧的回答", Name: "Kimi"},
+	})
+
+	if (&RetryAction{}).Execute(a) {
+		t.Fatal("Execute() = true, want false")
+	}
+	// 重新生成时使用指定的 temperature，请求中不包含旧的回答
+	if len(llm.settings) != 1 || llm.settings[0].Temperature == nil || *llm.settings[0].Temperature != 0.8 {
+		t.Errorf("request settings = %+v", llm.settings)
+	}
+	requests := llm.Requests()
+	if len(requests) != 1 || requests[0][len(requests[0])-1].Content != "写一首诗" {
+		t.Errorf("requests = %+v", requests)
+	}
+	msg := a.handler.sessionCache.GetMsg(sessionId)
+	if len(msg) != 3 || msg[2].Content != "新的回答" {
+		t.Errorf("session msg = %+v", msg)
+	}
+	if card := lk.lastPatch(); !strings.Contains(card, "新的回答") {
+		t.Errorf("answer card = %s", card)
+	}
+	// 指定的 temperature 只对本次生成生效，不写入会话设置
+	if settings := a.handler.sessionCache.GetSettings(sessionId); settings.Temperature != nil {
+		t.Errorf("session temperature = %v, want unset", *settings.Temperature)
+	}
+
+	a.info.qParsed = "/retry 3"
+	(&RetryAction{}).Execute(a)
+	if reply := lk.lastReply(); !strings.Contains(reply, "重新生成失败") {
+		t.Errorf("reply = %s", reply)
+	}
+	if len(llm.settings) != 1 {
+		t.Errorf("invalid temperature should not send a request, got %d", len(llm.settings))
+	}
+}
@@ -0,0 +1,19 @@
+package api
+
+import "github.com/blacklee123/feishu-kimi/pkg/utils"
+
+type RoleListAction struct { /*角色列表*/
+}
+
+func (*RoleListAction) Execute(a *ActionInfo) bool {
+	if _, foundRoles := utils.EitherTrimEqual(a.info.qParsed, "/roles", "角色列表"); foundRoles {
+		tags := a.handler.roles.Tags()
+		if len(tags) == 0 {
+			a.replyMsg(*a.ctx, "🤖️：暂未配置内置角色，请检查 ROLE_LIST_PATH", a.info.msgId)
+			return false
+		}
+		a.SendRoleTagsCard(*a.ctx, a.info.sessionId, a.info.msgId, tags)
+		return false
+	}
+	return true
+}
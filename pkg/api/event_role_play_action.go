@@ -0,0 +1,31 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/blacklee123/feishu-kimi/pkg/services"
+	"github.com/blacklee123/feishu-kimi/pkg/utils"
+	"go.uber.org/zap"
+)
+
+type RolePlayAction struct { /*自定义系统提示词*/
+}
+
+func (*RolePlayAction) Execute(a *ActionInfo) bool {
+	if _, foundUsage := utils.EitherTrimEqual(a.info.qParsed, "/system", "角色扮演"); foundUsage {
+		a.replyMsg(*a.ctx, "🤖️：用法 /system 系统提示词", a.info.msgId)
+		return false
+	}
+	if system, foundSystem := utils.EitherCutPrefix(a.info.qParsed, "/system ", "角色扮演 "); foundSystem {
+		system = strings.TrimSpace(system)
+		if system == "" {
+			a.replyMsg(*a.ctx, "🤖️：用法 /system 系统提示词", a.info.msgId)
+			return false
+		}
+		a.handler.startSession(*a.info.sessionId, services.SessionSettings{SystemPrompt: system})
+		a.logger.Info("[system]", zap.String("sessionId", *a.info.sessionId))
+		a.sendSystemInstructionCard(*a.ctx, a.info.sessionId, a.info.msgId, system)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/blacklee123/feishu-kimi/pkg/services"
+	"github.com/blacklee123/feishu-kimi/pkg/utils"
+)
+
+type SettingsAction struct { /*会话设置*/
+}
+
+func (*SettingsAction) Execute(a *ActionInfo) bool {
+	if _, foundSettings := utils.EitherTrimEqual(a.info.qParsed, "/settings", "设置"); foundSettings {
+		settings := a.handler.sessionCache.GetSettings(*a.info.sessionId)
+		a.sendSettingsCard(*a.ctx, a.info.sessionId, a.info.msgId, settings)
+		return false
+	}
+	if matched, key, value := utils.MatchSet(a.info.qParsed); matched {
+		settings := a.handler.sessionCache.GetSettings(*a.info.sessionId)
+		err := settings.Set(key, value)
+		if err == nil {
+			err = services.CheckSettings(a.llm(), settings)
+		}
+		if err != nil {
+			a.replyMsg(*a.ctx, fmt.Sprintf("🤖️：设置失败\n错误信息: %v", err), a.info.msgId)
+			return false
+		}
+		a.handler.sessionCache.SetSettings(*a.info.sessionId, settings)
+		a.sendSettingsCard(*a.ctx, a.info.sessionId, a.info.msgId, settings)
+		return false
+	}
+	if _, foundSet := utils.EitherTrimEqual(a.info.qParsed, "/set"); foundSet {
+		a.replyMsg(*a.ctx, fmt.Sprintf("🤖️：用法 /set key value，value 为 default 时恢复默认\n可用的 key: %s", strings.Join(services.SettingKeys, ", ")), a.info.msgId)
+		return false
+	}
+	return true
+}
+
+// describeSettings 展示会话实际生效的设置
+func (a *ActionInfo) describeSettings(settings services.SessionSettings) string {
+	gpt := a.llm()
+	origin := func(custom bool) string {
+		if custom {
+			return "（话题设置）"
+		}
+		return "（默认）"
+	}
+	lines := []string{
+		fmt.Sprintf("**model**: %s %s", gpt.ModelOf(settings), origin(settings.Model != "")),
+		fmt.Sprintf("**max_tokens**: %d %s", gpt.MaxTokensOf(settings), origin(settings.MaxTokens > 0)),
+	}
+	if settings.Temperature != nil {
+		lines = append(lines, fmt.Sprintf("**temperature**: %v %s", *settings.Temperature, origin(true)))
+	} else {
+		lines = append(lines, fmt.Sprintf("**temperature**: 模型默认 %s", origin(false)))
+	}
+	if settings.TopP != nil {
+		lines = append(lines, fmt.Sprintf("**top_p**: %v %s", *settings.TopP, origin(true)))
+	} else {
+		lines = append(lines, fmt.Sprintf("**top_p**: 模型默认 %s", origin(false)))
+	}
+	if settings.Mode != "" {
+		lines = append(lines, fmt.Sprintf("**mode**: %s %s", settings.Mode, origin(true)))
+	}
+	if settings.SystemPrompt != "" {
+		lines = append(lines, fmt.Sprintf("**system_prompt**: %s %s", settings.SystemPrompt, origin(true)))
+	} else {
+		lines = append(lines, fmt.Sprintf("**system_prompt**: 默认 %s", origin(false)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// 设置卡片中可选的模型
+var moonshotModels = []string{"moonshot-v1-8k", "moonshot-v1-32k", "moonshot-v1-128k", "moonshot-v1-auto"}
+
+func settingModels(models ...string) []string {
+	var result []string
+	seen := map[string]bool{}
+	for _, m := range append(models, moonshotModels...) {
+		if !seen[m] {
+			seen[m] = true
+			result = append(result, m)
+		}
+	}
+	return result
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/blacklee123/feishu-kimi/pkg/utils"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+type UndoAction struct { /*撤销上一轮*/
+}
+
+func (*UndoAction) Execute(a *ActionInfo) bool {
+	if _, foundUndo := utils.EitherTrimEqual(a.info.qParsed, "/undo", "撤销"); !foundUndo {
+		return true
+	}
+	msg := a.handler.sessionCache.GetMsg(*a.info.sessionId)
+	i := lastUserIndex(msg)
+	if i < 0 {
+		a.replyMsg(*a.ctx, "🤖️：当前话题没有可以撤销的对话，请在话题内回复 /undo", a.info.msgId)
+		return false
+	}
+	question := msg[i].Content
+	a.handler.sessionCache.SetMsg(*a.info.sessionId, msg[:i])
+	a.replyMsg(*a.ctx, fmt.Sprintf("🤖️：已撤销上一轮对话：%s", truncateRunes(question, 50)), a.info.msgId)
+	return false
+}
+
+// lastUserIndex 返回最后一个用户问题的位置，不存在时返回 -1
+func lastUserIndex(msg []openai.ChatCompletionMessage) int {
+	for i := len(msg) - 1; i >= 0; i-- {
+		if msg[i].Role == openai.ChatMessageRoleUser {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blacklee123/feishu-kimi/pkg/services"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestUndoActionKeepsReadFile(t *testing.T) {
+	llm := services.NewFakeProvider("这是一份周报", "补充说明")
+	path := filepath.Join(t.TempDir(), "report.txt")
+	if err := os.WriteFile(path, []byte("文件内容"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	file, err := llm.CreateFile(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, lk := newTestActionInfo(t, llm, "/read "+file.ID+" 总结一下")
+	a.handler.prompts, _ = services.NewPromptTemplates("默认提示词", nil, "Asia/Shanghai")
+	a.info.newTopic = true
+	(&MessageAction{}).Execute(a)
+
+	// 在 /read 开启的话题中继续追问后撤销
+	a.info.newTopic = false
+	a.info.qParsed = "还有吗"
+	(&MessageAction{}).Execute(a)
+	if msg := a.handler.sessionCache.GetMsg(*a.info.sessionId); len(msg) != 6 {
+		t.Fatalf("session msg = %+v", msg)
+	}
+	a.info.qParsed = "/undo"
+	if (&UndoAction{}).Execute(a) {
+		t.Fatal("Execute() = true, want false")
+	}
+	if reply := lk.lastReply(); !strings.Contains(reply, "还有吗") {
+		t.Errorf("reply = %s", reply)
+	}
+
+	// 系统提示词和文件内容都保留
+	msg := a.handler.sessionCache.GetMsg(*a.info.sessionId)
+	if len(msg) != 4 {
+		t.Fatalf("session msg after undo = %+v", msg)
+	}
+	if msg[0].Role != openai.ChatMessageRoleSystem || msg[0].Content != "默认提示词" ||
+		msg[1].Role != openai.ChatMessageRoleSystem || msg[1].Content != "文件内容" {
+		t.Errorf("system messages = %+v", msg[:2])
+	}
+	if msg[2].Content != "总结一下" || msg[3].Content != "这是一份周报" {
+		t.Errorf("first turn = %+v", msg[2:])
+	}
+
+	// 撤销到只剩系统消息后，再次撤销没有可以撤销的对话
+	(&UndoAction{}).Execute(a)
+	if msg := a.handler.sessionCache.GetMsg(*a.info.sessionId); len(msg) != 2 {
+		t.Fatalf("session msg after second undo = %+v", msg)
+	}
+	(&UndoAction{}).Execute(a)
+	if reply := lk.lastReply(); !strings.Contains(reply, "没有可以撤销") {
+		t.Errorf("reply = %s", reply)
+	}
+	if msg := a.handler.sessionCache.GetMsg(*a.info.sessionId); len(msg) != 2 {
+		t.Errorf("session msg = %+v, want both system messages", msg)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/blacklee123/feishu-kimi/pkg/services"
 	"github.com/google/uuid"
 	lark "github.com/larksuite/oapi-sdk-go/v3"
+	larkcard "github.com/larksuite/oapi-sdk-go/v3/card"
 
 	"go.uber.org/zap"
 
@@ -27,6 +28,7 @@ func chain(data *ActionInfo, actions ...Action) bool {
 
 type MessageHandlerInterface interface {
 	MsgReceivedHandler(ctx context.Context, event *larkim.P2MessageReceiveV1) error
+	CardActionHandler(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error)
 }
 
 type HandlerType string
@@ -49,7 +51,11 @@ func judgeChatType(event *larkim.P2MessageReceiveV1) HandlerType {
 
 type MessageHandler struct {
 	sessionCache services.SessionServiceCacheInterface
-	gpt          *services.ChatGPT
+	gpt          services.LLMProvider // 默认的模型，用于文件接口
+	router       *services.Router
+	roles        *services.RoleCatalog
+	prompts      *services.PromptTemplates
+	tools        *services.ToolRegistry
 	config       Config
 	logger       *zap.Logger
 	larkClient   *lark.Client
@@ -128,6 +134,15 @@ func (m MessageHandler) MsgReceivedHandler(ctx context.Context, event *larkim.P2
 		if sessionId == nil || *sessionId == "" {
 			sessionId = msgId
 		}
+		// 同一会话的消息串行处理，多副本时通过共享存储加锁
+		unlock, err := m.sessionCache.Lock(*sessionId)
+		if err != nil {
+			m.replyMsg(ctx, "🤖️：当前话题正在处理中，请稍后再试～", msgId)
+			m.logger.Error("lock session error", zap.String("sessionId", *sessionId), zap.Error(err))
+			return
+		}
+		defer unlock()
+
 		qParsed := strings.Trim(parseContent(*content, msgType), " ")
 		m.logger.Info("[receive]", zap.String("messageid", *event.Event.Message.MessageId), zap.String("MessageType", *event.Event.Message.MessageType), zap.String("qParsed", qParsed))
 		imageKeys := []string{}
@@ -157,22 +172,42 @@ func (m MessageHandler) MsgReceivedHandler(ctx context.Context, event *larkim.P2
 			larkClient: m.larkClient,
 		}
 		actions := []Action{
-			&HelpAction{},    //帮助处理
-			&PreAction{},     //预处理
-			&FileAction{},    //文件处理
-			&MessageAction{}, //消息处理
+			&HelpAction{},     //帮助处理
+			&ExportAction{},   //导出对话
+			&ImportAction{},   //导入对话
+			&SettingsAction{}, //会话设置
+			&HistoryAction{},  //历史话题
+			&ForkAction{},     //分叉话题
+			&RoleListAction{}, //角色列表
+			&RolePlayAction{}, //角色扮演
+			&AIModeAction{},   //回答模式
+			&ClearAction{},    //清除上下文
+			&UndoAction{},     //撤销上一轮
+			&RetryAction{},    //重新生成
+			&PreAction{},      //预处理
+			&FileAction{},     //文件处理
+			&MessageAction{},  //消息处理
 		}
 		chain(data, actions...)
 	}()
 	return nil
 }
 
+func (m MessageHandler) CardActionHandler(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
+	return NewCardHandler(m)(ctx, cardAction)
+}
+
 var _ MessageHandlerInterface = (*MessageHandler)(nil)
 
-func NewMessageHandler(gpt *services.ChatGPT, config Config, logger *zap.Logger, larkClient *lark.Client) MessageHandlerInterface {
+func NewMessageHandler(router *services.Router, roles *services.RoleCatalog, prompts *services.PromptTemplates,
+	tools *services.ToolRegistry, config Config, logger *zap.Logger, larkClient *lark.Client) MessageHandlerInterface {
 	return &MessageHandler{
 		sessionCache: services.GetSessionCache(),
-		gpt:          gpt,
+		gpt:          router.Default(),
+		router:       router,
+		roles:        roles,
+		prompts:      prompts,
+		tools:        tools,
 		config:       config,
 		logger:       logger,
 		larkClient:   larkClient,
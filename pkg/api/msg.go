@@ -4,15 +4,19 @@ import (
 	"bytes"
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 
+	"github.com/blacklee123/feishu-kimi/pkg/services"
 	"github.com/google/uuid"
 	larkcard "github.com/larksuite/oapi-sdk-go/v3/card"
 	larkcontact "github.com/larksuite/oapi-sdk-go/v3/service/contact/v3"
 	larkim "github.com/larksuite/oapi-sdk-go/v3/service/im/v1"
+	openai "github.com/sashabaranov/go-openai"
 )
 
 type CardKind string
@@ -30,6 +34,9 @@ var (
 	RoleTagsChooseKind   = CardKind("role_tags_choose") // 内置角色所属标签选择
 	RoleChooseKind       = CardKind("role_choose")      // 内置角色选择
 	AIModeChooseKind     = CardKind("ai_mode_choose")   // AI模式选择
+	SettingsKind         = CardKind("settings")         // 会话设置
+	HistoryKind          = CardKind("history")          // 继续历史话题
+	AnswerKind           = CardKind("answer")           // 回答卡片上的操作
 )
 
 var (
@@ -43,6 +50,7 @@ type CardMsg struct {
 	Value     interface{}
 	SessionId string
 	MsgId     string
+	MsgIndex  int // 回答在会话中的位置
 }
 
 type MenuOption struct {
@@ -75,6 +83,45 @@ func (a *ActionInfo) retrieveUserInfo(ctx context.Context, userId string) (*lark
 	return resp.Data.User, nil
 }
 
+func (a *ActionInfo) retrieveDepartmentName(ctx context.Context, departmentId string) (string, error) {
+	client := a.larkClient
+	req := larkcontact.NewGetDepartmentReqBuilder().
+		DepartmentId(departmentId).
+		DepartmentIdType(`open_department_id`).
+		Build()
+
+	resp, err := client.Contact.Department.Get(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	if !resp.Success() {
+		return "", errors.New(resp.Msg)
+	}
+	if resp.Data.Department == nil || resp.Data.Department.Name == nil {
+		return "", nil
+	}
+	return *resp.Data.Department.Name, nil
+}
+
+func (a *ActionInfo) retrieveChatName(ctx context.Context, chatId string) (string, error) {
+	client := a.larkClient
+	req := larkim.NewGetChatReqBuilder().
+		ChatId(chatId).
+		Build()
+
+	resp, err := client.Im.Chat.Get(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	if !resp.Success() {
+		return "", errors.New(resp.Msg)
+	}
+	if resp.Data.Name == nil {
+		return "", nil
+	}
+	return *resp.Data.Name, nil
+}
+
 func (a *ActionInfo) replyCard(ctx context.Context, msgId *string, cardContent string) error {
 	client := a.larkClient
 	resp, err := client.Im.Message.Reply(ctx, larkim.NewReplyMessageReqBuilder().
@@ -289,6 +336,137 @@ func newMenu(
 	return btn
 }
 
+// cardElement 用于构造 SDK 尚未支持的卡片组件，例如表单和输入框
+type cardElement map[string]interface{}
+
+func (e cardElement) Tag() string {
+	return e["tag"].(string)
+}
+
+func (e cardElement) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}(e))
+}
+
+func plainText(content string) map[string]interface{} {
+	return map[string]interface{}{"tag": "plain_text", "content": content}
+}
+
+// withForm 用于生成表单容器，提交时所有组件的值通过 form_value 一起回调
+func withForm(name string, elements ...larkcard.MessageCardElement) larkcard.MessageCardElement {
+	return cardElement{
+		"tag":      "form",
+		"name":     name,
+		"elements": elements,
+	}
+}
+
+func newFormSelect(name string, placeHolder string, initial string,
+	options ...MenuOption) larkcard.MessageCardElement {
+	var aOptionPool []map[string]interface{}
+	for _, option := range options {
+		aOptionPool = append(aOptionPool, map[string]interface{}{
+			"text":  plainText(option.label),
+			"value": option.value,
+		})
+	}
+	selectMenu := cardElement{
+		"tag":         "select_static",
+		"name":        name,
+		"placeholder": plainText(placeHolder),
+		"options":     aOptionPool,
+	}
+	if initial != "" {
+		selectMenu["initial_option"] = initial
+	}
+	return selectMenu
+}
+
+func newFormInput(name string, label string, placeHolder string,
+	defaultValue string) larkcard.MessageCardElement {
+	return cardElement{
+		"tag":           "input",
+		"name":          name,
+		"label":         plainText(label),
+		"placeholder":   plainText(placeHolder),
+		"default_value": defaultValue,
+		"max_length":    1000,
+	}
+}
+
+func newFormSubmitBtn(content string, value map[string]interface{}) larkcard.MessageCardElement {
+	return cardElement{
+		"tag":         "button",
+		"name":        "submit",
+		"action_type": "form_submit",
+		"type":        larkcard.MessageCardButtonTypePrimary,
+		"text":        plainText(content),
+		"value":       value,
+	}
+}
+
+// withSettingsForm 会话设置表单
+func withSettingsForm(sessionID *string, msgID *string, models []string,
+	settings services.SessionSettings, model string) larkcard.MessageCardElement {
+	var modelOptions []MenuOption
+	for _, m := range models {
+		modelOptions = append(modelOptions, MenuOption{label: m, value: m})
+	}
+	var creativityOptions []MenuOption
+	for _, mode := range services.AIModes {
+		creativityOptions = append(creativityOptions, MenuOption{
+			label: fmt.Sprintf("%s（temperature %v，top_p %v）", mode.Label, mode.Temperature, mode.TopP),
+			value: mode.Label,
+		})
+	}
+	return withForm("settings",
+		newFormSelect("model", "选择模型", model, modelOptions...),
+		newFormSelect("creativity", "选择创意程度", settings.Creativity(), creativityOptions...),
+		newFormInput("system_prompt", "系统提示词", "留空则使用默认的系统提示词", settings.SystemPrompt),
+		newFormSubmitBtn("保存设置", map[string]interface{}{
+			"kind":      SettingsKind,
+			"chatType":  UserChatType,
+			"sessionId": *sessionID,
+			"msgId":     *msgID,
+		}),
+	)
+}
+
+// 回答卡片上的操作
+const (
+	AnswerRegenerate = "regenerate"
+	AnswerContinue   = "continue"
+	AnswerCopy       = "copy"
+	AnswerNewTopic   = "new_topic"
+)
+
+func withAnswerBtns(sessionID *string, msgID *string, msgIndex int,
+	finishReason openai.FinishReason) larkcard.MessageCardElement {
+	btn := func(content string, action string, btnType larkcard.MessageCardButtonType) *larkcard.MessageCardEmbedButton {
+		return newBtn(content, map[string]interface{}{
+			"value":     action,
+			"kind":      AnswerKind,
+			"chatType":  UserChatType,
+			"sessionId": *sessionID,
+			"msgId":     *msgID,
+			"msgIndex":  msgIndex,
+		}, btnType)
+	}
+	btns := []larkcard.MessageCardActionElement{
+		btn("🔄 重新生成", AnswerRegenerate, larkcard.MessageCardButtonTypeDefault),
+	}
+	// 因长度限制截断时才可以继续生成
+	if finishReason == openai.FinishReasonLength {
+		btns = append(btns, btn("⏩ 继续生成", AnswerContinue, larkcard.MessageCardButtonTypePrimary))
+	}
+	btns = append(btns,
+		btn("📋 复制", AnswerCopy, larkcard.MessageCardButtonTypeDefault),
+		btn("👻 新话题", AnswerNewTopic, larkcard.MessageCardButtonTypeDefault))
+	return larkcard.NewMessageCardAction().
+		Actions(btns).
+		Layout(larkcard.MessageCardActionLayoutFlow.Ptr()).
+		Build()
+}
+
 // 清除卡片按钮
 func withClearDoubleCheckBtn(sessionID *string) larkcard.MessageCardElement {
 	confirmBtn := newBtn("确认清除", map[string]interface{}{
@@ -372,6 +550,17 @@ func withOneBtn(btn *larkcard.MessageCardEmbedButton) larkcard.
 	return actions
 }
 
+func withHistoryBtn(entry services.HistoryEntry) larkcard.
+	MessageCardElement {
+	return withOneBtn(newBtn("继续对话", map[string]interface{}{
+		"value":     entry.Question,
+		"kind":      HistoryKind,
+		"chatType":  UserChatType,
+		"sessionId": entry.SessionId,
+		"msgId":     entry.SessionId,
+	}, larkcard.MessageCardButtonTypeDefault))
+}
+
 func withRoleTagsBtn(sessionID *string, tags ...string) larkcard.
 	MessageCardElement {
 	var menuOptions []MenuOption
@@ -549,6 +738,63 @@ func (a *ActionInfo) uploadOpus(f *os.File, fileName string) (string, error) {
 	return *resp.Data.FileKey, nil
 }
 
+func (a *ActionInfo) uploadFile(f io.Reader, fileName string) (string, error) {
+	fileReq := larkim.NewCreateFileReqBuilder().
+		Body(larkim.NewCreateFileReqBodyBuilder().
+			FileType("stream").
+			FileName(fileName).
+			File(f).
+			Build()).
+		Build()
+	client := a.larkClient
+	resp, err := client.Im.File.Create(context.Background(), fileReq)
+	// 处理错误
+	if err != nil {
+		fmt.Println(err)
+		return "", err
+	}
+
+	// 服务端错误处理
+	if !resp.Success() {
+		fmt.Println(resp.Code, resp.Msg, resp.RequestId())
+		return "", errors.New(resp.Msg)
+	}
+	return *resp.Data.FileKey, nil
+}
+
+func (a *ActionInfo) replyFile(ctx context.Context, fileKey string,
+	msgId *string) error {
+	msgFile := larkim.MessageFile{FileKey: fileKey}
+	content, err := msgFile.String()
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+	client := a.larkClient
+
+	resp, err := client.Im.Message.Reply(ctx, larkim.NewReplyMessageReqBuilder().
+		MessageId(*msgId).
+		Body(larkim.NewReplyMessageReqBodyBuilder().
+			MsgType(larkim.MsgTypeFile).
+			Uuid(uuid.New().String()).
+			Content(content).
+			Build()).
+		Build())
+
+	// 处理错误
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	// 服务端错误处理
+	if !resp.Success() {
+		fmt.Println(resp.Code, resp.Msg, resp.RequestId())
+		return errors.New(resp.Msg)
+	}
+	return nil
+}
+
 func (a *ActionInfo) replyImage(ctx context.Context, ImageKey *string,
 	msgId *string) error {
 	//fmt.Println("sendMsg", ImageKey, msgId)
@@ -750,6 +996,25 @@ func (a *ActionInfo) sendOldTopicCard(ctx context.Context,
 	a.replyCard(ctx, msgId, newCard)
 }
 
+func (a *ActionInfo) sendForkCard(ctx context.Context,
+	chatId *string, content string) (*string, error) {
+	newCard, _ := newSendCard(
+		withHeader("🌿 已分叉出新的话题", larkcard.TemplateGreen),
+		withMainMd(content),
+		withNote("提醒：回复这条消息即可在新话题中继续，原话题不受影响"))
+	return a.sendCardWithBackId(ctx, chatId, newCard)
+}
+
+func (a *ActionInfo) sendClearCacheCheckCard(ctx context.Context,
+	sessionId *string, msgId *string) {
+	newCard, _ := newSendCard(
+		withHeader("🆑 机器人提醒", larkcard.TemplateBlue),
+		withMainMd("您确定要清除对话上下文吗？"),
+		withNote("请注意，这将开始一个全新的对话，您将无法利用之前话题的历史信息"),
+		withClearDoubleCheckBtn(sessionId))
+	a.replyCard(ctx, msgId, newCard)
+}
+
 func (a *ActionInfo) sendHelpCard(ctx context.Context,
 	sessionId *string, msgId *string) {
 	newCard, _ := newSendCard(
@@ -761,10 +1026,61 @@ func (a *ActionInfo) sendHelpCard(ctx context.Context,
 		withMainMd("/delete *id* 删除id对应的文件"),
 		withMainMd("/preview *id* 预览id对应的文件内容"),
 		withMainMd("/read *id* *prompt* 基于id对应的文件进行对话"),
+		withSplitLine(),
+		withMainMd("/export *md|json* 在话题内导出当前对话记录"),
+		withMainMd("/import 发送导出的 JSON 文件，基于它继续对话"),
+		withMainMd("/history 查看最近的话题，点击即可继续"),
+		withMainMd("/fork 将当前话题分叉为一个新的独立话题"),
+		withMainMd("/undo 撤销当前话题的上一轮对话"),
+		withMainMd("/clear 清除当前话题的上下文"),
+		withMainMd("/roles 选择内置角色，开启角色扮演"),
+		withMainMd("/system *prompt* 使用自定义的系统提示词开启新的话题"),
+		withMainMd("/mode *严谨|简洁|标准|发散* 切换当前话题的回答模式"),
+		withMainMd("/retry *temperature* 重新生成上一个回答，可临时指定 temperature"),
+		withSplitLine(),
+		withMainMd("/settings 查看当前话题的设置"),
+		withMainMd("/set *key* *value* 修改当前话题的 model、temperature、top_p、max_tokens"),
 	)
 	a.replyCard(ctx, msgId, newCard)
 }
 
+func (a *ActionInfo) newSettingsCard(sessionId *string, msgId *string,
+	settings services.SessionSettings, note string) (string, error) {
+	gpt := a.llm()
+	return newSendCard(
+		withHeader("⚙️ 当前话题设置", larkcard.TemplateBlue),
+		withMainMd(a.describeSettings(settings)),
+		withSplitLine(),
+		withSettingsForm(sessionId, msgId, settingModels(gpt.ModelOf(services.SessionSettings{}), gpt.ModelOf(settings)), settings, gpt.ModelOf(settings)),
+		withNote(note))
+}
+
+func (a *ActionInfo) sendSettingsCard(ctx context.Context,
+	sessionId *string, msgId *string, settings services.SessionSettings) {
+	newCard, _ := a.newSettingsCard(sessionId, msgId, settings,
+		"提醒：在本话题内回复即可使用以上设置，/set key default 恢复默认")
+	a.replyCard(ctx, msgId, newCard)
+}
+
+func (a *ActionInfo) sendHistoryCard(ctx context.Context,
+	msgId *string, history []services.HistoryEntry) {
+	var elements []larkcard.MessageCardElement
+	for i, entry := range history {
+		if i > 0 {
+			elements = append(elements, withSplitLine())
+		}
+		elements = append(elements,
+			withMainMd(fmt.Sprintf("**%s**\n%s · %d 条消息",
+				entry.Question, entry.LastActiveAt.Format("2006-01-02 15:04"), entry.MessageCount)),
+			withHistoryBtn(entry))
+	}
+	elements = append(elements, withNote("提醒：点击继续对话后，在回复的话题内继续提问即可"))
+	newCard, _ := newSendCard(
+		withHeader("🗂️ 最近的话题", larkcard.TemplateBlue),
+		elements...)
+	a.replyCard(ctx, msgId, newCard)
+}
+
 func (a *ActionInfo) sendImageCard(ctx context.Context, imageKey string,
 	msgId *string, sessionId *string, question string) error {
 	newCard, _ := newSimpleSendCard(
@@ -822,19 +1138,27 @@ func (a *ActionInfo) SendAIModeListsCard(ctx context.Context,
 	a.replyCard(ctx, msgId, newCard)
 }
 
+// topicHeader 根据话题状态生成卡片头
+func (a *ActionInfo) topicHeader(ifNewTopic bool) *larkcard.MessageCardHeader {
+	if !ifNewTopic {
+		return withHeader("🔃️ 上下文的话题", larkcard.TemplateBlue)
+	}
+	if a.info != nil && a.info.expired {
+		return withHeader("⌛️ 之前的上下文已过期，已开启新的话题", larkcard.TemplateOrange)
+	}
+	return withHeader("👻️ 已开启新的话题", larkcard.TemplateBlue)
+}
+
 func (a *ActionInfo) sendOnProcessCard(ctx context.Context,
 	sessionId *string, msgId *string, ifNewTopic bool) (*string,
 	error) {
-	var newCard string
-	if ifNewTopic {
-		newCard, _ = newSendCard(
-			withHeader("👻️ 已开启新的话题", larkcard.TemplateBlue),
-			withNote("正在思考，请稍等..."))
-	} else {
-		newCard, _ = newSendCard(
-			withHeader("🔃️ 上下文的话题", larkcard.TemplateBlue),
-			withNote("正在思考，请稍等..."))
+	note := "正在思考，请稍等..."
+	if ifNewTopic && a.info.expired {
+		note = "之前的对话已超过有效期，本次回答不会参考之前的内容。正在思考，请稍等..."
 	}
+	newCard, _ := newSendCard(
+		a.topicHeader(ifNewTopic),
+		withNote(note))
 
 	id, err := a.replyCardWithBackId(ctx, msgId, newCard)
 	if err != nil {
@@ -844,18 +1168,10 @@ func (a *ActionInfo) sendOnProcessCard(ctx context.Context,
 }
 
 func (a *ActionInfo) UpdateTextCard(ctx context.Context, msg string, msgId *string, ifNewTopic bool) error {
-	var newCard string
-	if ifNewTopic {
-		newCard, _ = newSendCard(
-			withHeader("👻️ 已开启新的话题", larkcard.TemplateBlue),
-			withMainMd(msg),
-			withNote("正在生成，请稍等..."))
-	} else {
-		newCard, _ = newSendCard(
-			withHeader("🔃️ 上下文的话题", larkcard.TemplateBlue),
-			withMainMd(msg),
-			withNote("正在生成，请稍等..."))
-	}
+	newCard, _ := newSendCard(
+		a.topicHeader(ifNewTopic),
+		withMainMd(msg),
+		withNote("正在生成，请稍等..."))
 	err := a.PatchCard(ctx, msgId, newCard)
 	if err != nil {
 		return err
@@ -868,19 +1184,10 @@ func (a *ActionInfo) updateFinalCard(
 	msgId *string,
 	ifNewSession bool,
 ) error {
-	var newCard string
-	if ifNewSession {
-		newCard, _ = newSendCard(
-			withHeader("👻️ 已开启新的话题", larkcard.TemplateBlue),
-			withMainMd(msg),
-			withNote("已完成，您可以继续提问或者选择其他功能。"))
-	} else {
-		newCard, _ = newSendCard(
-			withHeader("🔃️ 上下文的话题", larkcard.TemplateBlue),
-
-			withMainMd(msg),
-			withNote("已完成，您可以继续提问或者选择其他功能。"))
-	}
+	newCard, _ := newSendCard(
+		a.topicHeader(ifNewSession),
+		withMainMd(msg),
+		withNote("已完成，您可以继续提问或者选择其他功能。"))
 	err := a.PatchCard(ctx, msgId, newCard)
 	if err != nil {
 		return err
@@ -888,6 +1195,37 @@ func (a *ActionInfo) updateFinalCard(
 	return nil
 }
 
+// updateAnswerCard 更新最终的回答卡片，并附带回答的操作按钮，因长度限制截断的回答会提示继续生成
+func (a *ActionInfo) updateAnswerCard(
+	ctx context.Context,
+	msg string,
+	msgId *string,
+	ifNewSession bool,
+	msgIndex int,
+	finishReason openai.FinishReason,
+) error {
+	note := "已完成，您可以继续提问或者选择其他功能。"
+	if finishReason == openai.FinishReasonLength {
+		msg += " ……"
+		note = "⚠️ 回答达到长度上限被截断，可以点击「继续生成」接着输出。"
+	}
+	newCard, _ := newSendCard(
+		a.topicHeader(ifNewSession),
+		withMainMd(msg),
+		withNote(note),
+		withAnswerBtns(a.info.sessionId, msgId, msgIndex, finishReason))
+	return a.PatchCard(ctx, msgId, newCard)
+}
+
+func (a *ActionInfo) sendNewTopicCardWithBackId(ctx context.Context,
+	chatId *string) (*string, error) {
+	newCard, _ := newSendCard(
+		withHeader("👻️ 已开启新的话题", larkcard.TemplateBlue),
+		withMainMd("回复这条消息即可开始新的对话"),
+		withNote("提醒：点击对话框参与回复，可保持话题连贯"))
+	return a.sendCardWithBackId(ctx, chatId, newCard)
+}
+
 func newSendCardWithOutHeader(
 	elements ...larkcard.MessageCardElement) (string, error) {
 	config := larkcard.NewMessageCardConfig().
@@ -938,6 +1276,36 @@ func (a *ActionInfo) PatchCard(ctx context.Context, msgId *string,
 	return nil
 }
 
+// sendCardWithBackId 在会话中发送一条新的卡片消息，返回消息 id
+func (a *ActionInfo) sendCardWithBackId(ctx context.Context,
+	chatId *string,
+	cardContent string,
+) (*string, error) {
+	client := a.larkClient
+	resp, err := client.Im.Message.Create(ctx, larkim.NewCreateMessageReqBuilder().
+		ReceiveIdType(larkim.ReceiveIdTypeChatId).
+		Body(larkim.NewCreateMessageReqBodyBuilder().
+			MsgType(larkim.MsgTypeInteractive).
+			ReceiveId(*chatId).
+			Uuid(uuid.New().String()).
+			Content(cardContent).
+			Build()).
+		Build())
+
+	// 处理错误
+	if err != nil {
+		fmt.Println(err)
+		return nil, err
+	}
+
+	// 服务端错误处理
+	if !resp.Success() {
+		fmt.Println(resp.Code, resp.Msg, resp.RequestId())
+		return nil, errors.New(resp.Msg)
+	}
+	return resp.Data.MessageId, nil
+}
+
 func (a *ActionInfo) replyCardWithBackId(ctx context.Context,
 	msgId *string,
 	cardContent string,
@@ -2,14 +2,18 @@ package api
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"time"
 
 	"github.com/blacklee123/feishu-kimi/pkg/services"
 	lark "github.com/larksuite/oapi-sdk-go/v3"
+	larkcard "github.com/larksuite/oapi-sdk-go/v3/card"
 	larkcore "github.com/larksuite/oapi-sdk-go/v3/core"
+	"github.com/larksuite/oapi-sdk-go/v3/core/httpserverext"
 	"github.com/larksuite/oapi-sdk-go/v3/event/dispatcher"
 	larkws "github.com/larksuite/oapi-sdk-go/v3/ws"
-	openai "github.com/sashabaranov/go-openai"
 	"go.uber.org/zap"
 )
 
@@ -19,50 +23,228 @@ type Config struct {
 	FeishuEncryptKey        string `mapstructure:"FEISHU_ENCRYPT_KEY"`
 	FeishuVerificationToken string `mapstructure:"FEISHU_VERIFICATION_TOKEN"`
 
-	OpenaiApiKey    string `mapstructure:"OPENAI_KEY"`
-	OpenaiModel     string `mapstructure:"OPENAI_MODEL"`
-	OpenaiMaxTokens int    `mapstructure:"OPENAI_MAX_TOKENS"`
-	OpenaiApiUrl    string `mapstructure:"OPENAI_API_URL"`
+	OpenaiApiKeys     []string      `mapstructure:"OPENAI_KEY"`
+	OpenaiModel       string        `mapstructure:"OPENAI_MODEL"`
+	OpenaiMaxTokens   int           `mapstructure:"OPENAI_MAX_TOKENS"`
+	OpenaiApiUrl      string        `mapstructure:"OPENAI_API_URL"`
+	OpenaiKeyStrategy string        `mapstructure:"OPENAI_KEY_STRATEGY"`
+	OpenaiKeyCooldown time.Duration `mapstructure:"OPENAI_KEY_COOLDOWN"`
+
+	OpenaiMaxAttempts    int           `mapstructure:"OPENAI_MAX_ATTEMPTS"`
+	OpenaiRetryBaseDelay time.Duration `mapstructure:"OPENAI_RETRY_BASE_DELAY"`
+	OpenaiRetryMaxDelay  time.Duration `mapstructure:"OPENAI_RETRY_MAX_DELAY"`
+
+	SessionStore     string `mapstructure:"SESSION_STORE"`
+	SessionStorePath string `mapstructure:"SESSION_STORE_PATH"`
+	RedisAddr        string `mapstructure:"REDIS_ADDR"`
+	RedisPassword    string `mapstructure:"REDIS_PASSWORD"`
+	RedisDB          int    `mapstructure:"REDIS_DB"`
+
+	SessionLifetimeP2P   time.Duration `mapstructure:"SESSION_LIFETIME_P2P"`
+	SessionIdleP2P       time.Duration `mapstructure:"SESSION_IDLE_P2P"`
+	SessionLifetimeGroup time.Duration `mapstructure:"SESSION_LIFETIME_GROUP"`
+	SessionIdleGroup     time.Duration `mapstructure:"SESSION_IDLE_GROUP"`
+
+	HttpPort   int    `mapstructure:"HTTP_PORT"`
+	AdminToken string `mapstructure:"ADMIN_TOKEN"`
+
+	RoleListPath string `mapstructure:"ROLE_LIST_PATH"`
+
+	SystemPrompt      string            `mapstructure:"SYSTEM_PROMPT"`
+	ChatSystemPrompts map[string]string `mapstructure:"CHAT_SYSTEM_PROMPTS"` // 按 chat_id 配置的系统提示词
+	Timezone          string            `mapstructure:"TIMEZONE"`
+
+	ModelProfiles []services.ModelProfile `mapstructure:"MODEL_PROFILES"`
+	ModelRoutes   []services.RouteRule    `mapstructure:"MODEL_ROUTES"`
+	ModelFallback []string                `mapstructure:"MODEL_FALLBACK"`
+
+	Tools []string `mapstructure:"TOOLS"`
+}
+
+// Redacted 返回隐藏了密钥的配置副本，用于打印日志
+func (c Config) Redacted() Config {
+	mask := func(keys []string) []string {
+		var masked []string
+		for _, key := range keys {
+			masked = append(masked, services.MaskKey(key))
+		}
+		return masked
+	}
+	c.FeishuAppSecret = services.MaskKey(c.FeishuAppSecret)
+	c.FeishuEncryptKey = services.MaskKey(c.FeishuEncryptKey)
+	c.FeishuVerificationToken = services.MaskKey(c.FeishuVerificationToken)
+	c.OpenaiApiKeys = mask(c.OpenaiApiKeys)
+	c.RedisPassword = services.MaskKey(c.RedisPassword)
+	c.AdminToken = services.MaskKey(c.AdminToken)
+	profiles := make([]services.ModelProfile, len(c.ModelProfiles))
+	for i, profile := range c.ModelProfiles {
+		profile.ApiKeys = mask(profile.ApiKeys)
+		profiles[i] = profile
+	}
+	c.ModelProfiles = profiles
+	return c
 }
 
 type Server struct {
-	gpt          *services.ChatGPT
+	router       *services.Router
 	logger       *zap.Logger
 	config       *Config
 	larkClient   *lark.Client
 	larkWsClient *larkws.Client
+	httpServer   *http.Server
 }
 
 func NewServer(config *Config, logger *zap.Logger) (*Server, error) {
+	store, err := services.NewSessionStore(services.SessionStoreConfig{
+		Type: config.SessionStore,
+		Path: config.SessionStorePath,
 
-	defaultConfig := openai.DefaultConfig(config.OpenaiApiKey)
-	defaultConfig.BaseURL = config.OpenaiApiUrl
-	client := openai.NewClientWithConfig(defaultConfig)
-	srv := &Server{
-		logger: logger,
-		config: config,
-		gpt: &services.ChatGPT{
-			ApiKey:    config.OpenaiApiKey,
-			ApiUrl:    config.OpenaiApiUrl,
-			Model:     config.OpenaiModel,
-			MaxTokens: config.OpenaiMaxTokens,
-			Client:    client,
-			Logger:    logger,
+		RedisAddr:     config.RedisAddr,
+		RedisPassword: config.RedisPassword,
+		RedisDB:       config.RedisDB,
+	})
+	if err != nil {
+		return nil, err
+	}
+	services.InitSessionCache(store, map[string]services.SessionPolicy{
+		services.ChatTypeP2P: {
+			Lifetime: config.SessionLifetimeP2P,
+			Idle:     config.SessionIdleP2P,
 		},
+		services.ChatTypeGroup: {
+			Lifetime: config.SessionLifetimeGroup,
+			Idle:     config.SessionIdleGroup,
+		},
+	})
+
+	roles, err := services.LoadRoleCatalog(config.RoleListPath)
+	if err != nil {
+		return nil, fmt.Errorf("load roles: %w", err)
+	}
+	logger.Info("roles loaded", zap.String("path", config.RoleListPath), zap.Int("count", roles.Len()))
+	prompts, err := services.NewPromptTemplates(config.SystemPrompt, config.ChatSystemPrompts, config.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	router, err := newModelRouter(config, logger)
+	if err != nil {
+		return nil, err
+	}
+	if err := roles.Check(router.Default()); err != nil {
+		return nil, fmt.Errorf("load roles: %w", err)
+	}
+	srv := &Server{
+		logger:     logger,
+		config:     config,
+		router:     router,
 		larkClient: lark.NewClient(config.FeishuAppId, config.FeishuAppSecret, lark.WithLogLevel(larkcore.LogLevelError)),
 	}
-	handler := NewMessageHandler(srv.gpt, *config, logger, srv.larkClient)
+	tools, err := newToolRegistry(config, logger, srv.larkClient)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("tools loaded", zap.Strings("tools", tools.Names()))
+	handler := NewMessageHandler(srv.router, roles, prompts, tools, *config, logger, srv.larkClient)
 	eventHandler := dispatcher.NewEventDispatcher(
 		config.FeishuVerificationToken, config.FeishuEncryptKey).
 		OnP2MessageReceiveV1(handler.MsgReceivedHandler)
 	srv.larkWsClient = larkws.NewClient(config.FeishuAppId, config.FeishuAppSecret, larkws.WithEventHandler(eventHandler), larkws.WithLogLevel(larkcore.LogLevelDebug))
+
+	// 长连接暂不支持卡片回调，卡片交互通过 HTTP 回调接收
+	cardHandler := larkcard.NewCardActionHandler(
+		config.FeishuVerificationToken, config.FeishuEncryptKey, handler.CardActionHandler)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/webhook/card", httpserverext.NewCardActionHandlerFunc(cardHandler))
+	if config.AdminToken != "" {
+		mux.HandleFunc("/admin/keys", srv.handleKeyStats)
+	}
+	srv.httpServer = &http.Server{
+		Addr:    fmt.Sprintf(":%d", config.HttpPort),
+		Handler: mux,
+	}
 	return srv, nil
 }
 
+// newModelRouter 根据 OPENAI_* 生成 default 配置，MODEL_PROFILES 中未填写的字段沿用 default
+func newModelRouter(config *Config, logger *zap.Logger) (*services.Router, error) {
+	base := services.ModelProfile{
+		Name:        services.DefaultProfile,
+		ApiUrl:      config.OpenaiApiUrl,
+		ApiKeys:     config.OpenaiApiKeys,
+		Model:       config.OpenaiModel,
+		MaxTokens:   config.OpenaiMaxTokens,
+		KeyStrategy: config.OpenaiKeyStrategy,
+		KeyCooldown: config.OpenaiKeyCooldown,
+		Retry: services.RetryPolicy{
+			MaxAttempts: config.OpenaiMaxAttempts,
+			BaseDelay:   config.OpenaiRetryBaseDelay,
+			MaxDelay:    config.OpenaiRetryMaxDelay,
+		},
+	}
+	profiles := []services.ModelProfile{base}
+	for _, profile := range config.ModelProfiles {
+		if profile.Name == "" {
+			return nil, fmt.Errorf("model profile name is required")
+		}
+		if profile.ApiUrl == "" {
+			profile.ApiUrl = base.ApiUrl
+		}
+		if len(profile.ApiKeys) == 0 {
+			profile.ApiKeys = base.ApiKeys
+		}
+		if profile.Model == "" {
+			profile.Model = base.Model
+		}
+		if profile.MaxTokens <= 0 {
+			profile.MaxTokens = base.MaxTokens
+		}
+		if profile.KeyStrategy == "" {
+			profile.KeyStrategy = base.KeyStrategy
+		}
+		if profile.KeyCooldown <= 0 {
+			profile.KeyCooldown = base.KeyCooldown
+		}
+		if profile.Retry.MaxAttempts <= 0 {
+			profile.Retry.MaxAttempts = base.Retry.MaxAttempts
+		}
+		if profile.Retry.BaseDelay <= 0 {
+			profile.Retry.BaseDelay = base.Retry.BaseDelay
+		}
+		if profile.Retry.MaxDelay <= 0 {
+			profile.Retry.MaxDelay = base.Retry.MaxDelay
+		}
+		profiles = append(profiles, profile)
+	}
+	providers := map[string]services.LLMProvider{}
+	for _, profile := range profiles {
+		gpt, err := services.NewChatGPT(profile, logger)
+		if err != nil {
+			return nil, err
+		}
+		providers[profile.Name] = gpt
+		logger.Info("model profile loaded", zap.String("name", profile.Name), zap.String("apiUrl", profile.ApiUrl),
+			zap.String("model", profile.Model), zap.Int("keys", gpt.Keys.Len()), zap.String("keyStrategy", profile.KeyStrategy),
+			zap.Int("maxAttempts", gpt.Retry.MaxAttempts))
+	}
+	return services.NewRouter(providers, config.ModelRoutes, config.ModelFallback, logger)
+}
+
+// handleKeyStats 查看各模型配置的 key 池状态
+func (s *Server) handleKeyStats(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+s.config.AdminToken {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.router.KeyStats())
+}
+
 func (s *Server) ListenAndServe() {
 	// log version and port
 	s.logger.Info("config: ",
-		zap.String("confgi", fmt.Sprintf("%v", *s.config)),
+		zap.String("config", fmt.Sprintf("%+v", s.config.Redacted())),
+		zap.Any("keys", s.router.KeyStats()),
 	)
 	go func() {
 		err := s.larkWsClient.Start(context.Background())
@@ -70,4 +252,10 @@ func (s *Server) ListenAndServe() {
 			s.logger.Fatal("larkws  启动失败", zap.Error(err))
 		}
 	}()
+	go func() {
+		s.logger.Info("card callback listening", zap.String("addr", s.httpServer.Addr))
+		if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			s.logger.Fatal("卡片回调服务启动失败", zap.Error(err))
+		}
+	}()
 }
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/blacklee123/feishu-kimi/pkg/services"
+)
+
+func TestConfigRedacted(t *testing.T) {
+	config := Config{
+		FeishuAppSecret: "feishu-app-secret-value",
+		OpenaiApiKeys:   []string{"sk-pooled-key-0001", "sk-pooled-key-0002"},
+		RedisPassword:   "redis-password-value",
+		AdminToken:      "admin-token-value",
+		ModelProfiles: []services.ModelProfile{
+			{Name: "gpt", ApiKeys: []string{"sk-profile-key-0003"}},
+		},
+	}
+	redacted := fmt.Sprintf("%+v", config.Redacted())
+	for _, secret := range []string{"feishu-app-secret-value", "sk-pooled-key-0001", "sk-pooled-key-0002",
+		"redis-password-value", "admin-token-value", "sk-profile-key-0003"} {
+		if strings.Contains(redacted, secret) {
+			t.Errorf("Redacted() leaks %q: %s", secret, redacted)
+		}
+	}
+	// 不修改原配置
+	if config.OpenaiApiKeys[0] != "sk-pooled-key-0001" || config.ModelProfiles[0].ApiKeys[0] != "sk-profile-key-0003" {
+		t.Errorf("Redacted() modified the original config: %+v", config)
+	}
+}
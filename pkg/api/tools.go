@@ -0,0 +1,97 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/blacklee123/feishu-kimi/pkg/services"
+	lark "github.com/larksuite/oapi-sdk-go/v3"
+	"go.uber.org/zap"
+)
+
+// ToolLookupFeishuUser 查询飞书用户的工具名
+const ToolLookupFeishuUser = "lookup_feishu_user"
+
+// toolUserKey 工具调用的 ctx 中保存提问用户的 open_id
+type toolUserKey struct{}
+
+// newToolRegistry 按 TOOLS 配置的顺序注册内置工具，配置为 none 时不使用工具
+func newToolRegistry(config *Config, logger *zap.Logger, larkClient *lark.Client) (*services.ToolRegistry, error) {
+	registry := services.NewToolRegistry(logger)
+	for _, name := range config.Tools {
+		var tool services.Tool
+		switch name {
+		case "", "none":
+			continue
+		case services.ToolCalculator:
+			tool = services.NewCalculatorTool()
+		case services.ToolCurrentTime:
+			var err error
+			if tool, err = services.NewCurrentTimeTool(config.Timezone); err != nil {
+				return nil, err
+			}
+		case ToolLookupFeishuUser:
+			tool = newLookupUserTool(&ActionInfo{larkClient: larkClient, logger: logger})
+		default:
+			return nil, fmt.Errorf("unknown tool: %v", name)
+		}
+		if err := registry.Register(tool); err != nil {
+			return nil, err
+		}
+	}
+	return registry, nil
+}
+
+// newLookupUserTool 通过 retrieveUserInfo 查询飞书用户，不指定 open_id 时查询提问的用户
+func newLookupUserTool(a *ActionInfo) services.Tool {
+	return services.Tool{
+		Name:        ToolLookupFeishuUser,
+		Description: "查询飞书用户的姓名、邮箱、职务、城市和部门，不填 open_id 时查询当前提问的用户",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"open_id": {"type": "string", "description": "用户的 open_id，以 ou_ 开头，消息的 name 字段即为发送者的 open_id"}
+			}
+		}`),
+		Handler: func(ctx context.Context, arguments string) (string, error) {
+			var args struct {
+				OpenId string `json:"open_id"`
+			}
+			if arguments != "" {
+				if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+					return "", fmt.Errorf("invalid arguments: %w", err)
+				}
+			}
+			if args.OpenId == "" {
+				args.OpenId, _ = ctx.Value(toolUserKey{}).(string)
+			}
+			if args.OpenId == "" {
+				return "", fmt.Errorf("open_id is required")
+			}
+			user, err := a.retrieveUserInfo(ctx, args.OpenId)
+			if err != nil {
+				return "", err
+			}
+			info := map[string]string{"open_id": args.OpenId}
+			for key, value := range map[string]*string{
+				"name":      user.Name,
+				"en_name":   user.EnName,
+				"email":     user.Email,
+				"job_title": user.JobTitle,
+				"city":      user.City,
+			} {
+				if value != nil && *value != "" {
+					info[key] = *value
+				}
+			}
+			if len(user.DepartmentIds) > 0 {
+				if name, err := a.retrieveDepartmentName(ctx, user.DepartmentIds[0]); err == nil {
+					info["department"] = name
+				}
+			}
+			result, err := json.Marshal(info)
+			return string(result), err
+		},
+	}
+}
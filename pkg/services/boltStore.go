@@ -0,0 +1,182 @@
+package services
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	sessionBucket = []byte("sessions")
+	historyBucket = []byte("history")
+	flagBucket    = []byte("flags")
+)
+
+type boltStore struct {
+	db *bolt.DB
+	localLocker
+}
+
+type boltEntry struct {
+	ExpiresAt   int64          `json:"expires_at"`
+	SessionMeta *SessionMeta   `json:"session_meta,omitempty"`
+	History     []HistoryEntry `json:"history,omitempty"`
+}
+
+// NewBoltStore 基于 bbolt 的本地持久化存储，重启后会话不丢失
+func NewBoltStore(path string) (SessionStore, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second * 5})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{sessionBucket, historyBucket, flagBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	s := &boltStore{db: db}
+	go s.janitor(time.Hour * 1)
+	return s, nil
+}
+
+func (s *boltStore) Get(sessionId string) (*SessionMeta, bool) {
+	entry, ok := s.get(sessionBucket, sessionId)
+	if !ok || entry.SessionMeta == nil {
+		return nil, false
+	}
+	return entry.SessionMeta, true
+}
+
+func (s *boltStore) Set(sessionId string, sessionMeta *SessionMeta, expiration time.Duration) {
+	s.put(sessionBucket, sessionId, boltEntry{SessionMeta: sessionMeta}, expiration)
+}
+
+func (s *boltStore) Delete(sessionId string) {
+	s.delete(sessionBucket, sessionId)
+}
+
+func (s *boltStore) GetHistory(userId string) []HistoryEntry {
+	entry, ok := s.get(historyBucket, userId)
+	if !ok {
+		return nil
+	}
+	return entry.History
+}
+
+func (s *boltStore) SetHistory(userId string, history []HistoryEntry, expiration time.Duration) {
+	s.put(historyBucket, userId, boltEntry{History: history}, expiration)
+}
+
+func (s *boltStore) SetFlag(key string, expiration time.Duration) {
+	s.put(flagBucket, key, boltEntry{}, expiration)
+}
+
+func (s *boltStore) HasFlag(key string) bool {
+	_, ok := s.get(flagBucket, key)
+	return ok
+}
+
+func (s *boltStore) DeleteFlag(key string) {
+	s.delete(flagBucket, key)
+}
+
+func (s *boltStore) get(bucket []byte, key string) (*boltEntry, bool) {
+	var entry boltEntry
+	found := false
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bucket).Get([]byte(key))
+		if v == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(v, &entry)
+	})
+	if err != nil {
+		log.Printf("bolt store get %s error: %v", key, err)
+		return nil, false
+	}
+	if !found {
+		return nil, false
+	}
+	if entry.ExpiresAt > 0 && time.Now().UnixNano() > entry.ExpiresAt {
+		s.delete(bucket, key)
+		return nil, false
+	}
+	return &entry, true
+}
+
+func (s *boltStore) put(bucket []byte, key string, entry boltEntry, expiration time.Duration) {
+	if expiration > 0 {
+		entry.ExpiresAt = time.Now().Add(expiration).UnixNano()
+	}
+	v, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("bolt store marshal %s error: %v", key, err)
+		return
+	}
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put([]byte(key), v)
+	})
+	if err != nil {
+		log.Printf("bolt store set %s error: %v", key, err)
+	}
+}
+
+func (s *boltStore) delete(bucket []byte, key string) {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Delete([]byte(key))
+	})
+	if err != nil {
+		log.Printf("bolt store delete %s error: %v", key, err)
+	}
+}
+
+// janitor 定期清理过期的会话
+func (s *boltStore) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		now := time.Now().UnixNano()
+		err := s.db.Update(func(tx *bolt.Tx) error {
+			for _, name := range [][]byte{sessionBucket, historyBucket, flagBucket} {
+				bucket := tx.Bucket(name)
+				var expired [][]byte
+				err := bucket.ForEach(func(k, v []byte) error {
+					var entry boltEntry
+					if err := json.Unmarshal(v, &entry); err != nil || (entry.ExpiresAt > 0 && now > entry.ExpiresAt) {
+						expired = append(expired, append([]byte(nil), k...))
+					}
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+				for _, k := range expired {
+					if err := bucket.Delete(k); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("bolt store cleanup error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func newTestBoltStore(t *testing.T, path string) *boltStore {
+	store, err := NewBoltStore(path)
+	if err != nil {
+		t.Fatalf("NewBoltStore() error = %v", err)
+	}
+	s := store.(*boltStore)
+	t.Cleanup(func() { s.db.Close() })
+	return s
+}
+
+func TestBoltStoreGetSet(t *testing.T) {
+	store := newTestBoltStore(t, filepath.Join(t.TempDir(), "sessions.db"))
+
+	sessionMeta := &SessionMeta{
+		Mode: "chat",
+		Msg: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: "system"},
+			{Role: openai.ChatMessageRoleUser, Content: "hello", Name: "ou_1"},
+		},
+		Settings: SessionSettings{Model: "moonshot-v1-32k", MaxTokens: 1000},
+		ChatType: ChatTypeGroup,
+	}
+	store.Set("om_1", sessionMeta, time.Hour)
+	got, ok := store.Get("om_1")
+	if !ok {
+		t.Fatalf("Get() ok = false, want true")
+	}
+	if got.Mode != sessionMeta.Mode || len(got.Msg) != 2 || got.Msg[1].Name != "ou_1" ||
+		got.Settings.Model != "moonshot-v1-32k" || got.ChatType != ChatTypeGroup {
+		t.Errorf("Get() got = %+v, want %+v", got, sessionMeta)
+	}
+	if _, ok := store.Get("om_2"); ok {
+		t.Errorf("Get() unknown session ok = true, want false")
+	}
+
+	store.Delete("om_1")
+	if _, ok := store.Get("om_1"); ok {
+		t.Errorf("Get() after Delete ok = true, want false")
+	}
+}
+
+func TestBoltStoreReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "sessions.db")
+	store := newTestBoltStore(t, path)
+	store.Set("om_1", &SessionMeta{Msg: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hello"}}}, time.Hour)
+	store.SetHistory("ou_1", []HistoryEntry{{SessionId: "om_1", Question: "hello"}}, time.Hour)
+	store.db.Close()
+
+	// 重启后会话和话题索引仍然存在
+	reopened := newTestBoltStore(t, path)
+	got, ok := reopened.Get("om_1")
+	if !ok || len(got.Msg) != 1 || got.Msg[0].Content != "hello" {
+		t.Errorf("Get() after reopen = %+v, %v", got, ok)
+	}
+	if history := reopened.GetHistory("ou_1"); len(history) != 1 || history[0].SessionId != "om_1" {
+		t.Errorf("GetHistory() after reopen = %+v", history)
+	}
+}
+
+func TestBoltStoreExpiration(t *testing.T) {
+	store := newTestBoltStore(t, filepath.Join(t.TempDir(), "sessions.db"))
+	store.Set("om_1", &SessionMeta{Mode: "chat"}, time.Millisecond*50)
+	store.Set("om_2", &SessionMeta{Mode: "chat"}, 0)
+	store.SetHistory("ou_1", []HistoryEntry{{SessionId: "om_1"}}, time.Millisecond*50)
+	if _, ok := store.Get("om_1"); !ok {
+		t.Fatalf("Get() before expiration ok = false, want true")
+	}
+	time.Sleep(time.Millisecond * 100)
+	if _, ok := store.Get("om_1"); ok {
+		t.Errorf("Get() after expiration ok = true, want false")
+	}
+	if history := store.GetHistory("ou_1"); history != nil {
+		t.Errorf("GetHistory() after expiration = %+v, want nil", history)
+	}
+	// 过期时间为 0 时不过期
+	if _, ok := store.Get("om_2"); !ok {
+		t.Errorf("Get() without expiration ok = false, want true")
+	}
+	// 读取时发现过期会删除记录
+	if entry, ok := store.get(sessionBucket, "om_1"); ok || entry != nil {
+		t.Errorf("expired entry still readable: %+v", entry)
+	}
+}
+
+func TestBoltStoreFlag(t *testing.T) {
+	store := newTestBoltStore(t, filepath.Join(t.TempDir(), "sessions.db"))
+	store.SetFlag("import:oc_1:ou_1", time.Millisecond*50)
+	if !store.HasFlag("import:oc_1:ou_1") {
+		t.Fatal("HasFlag() = false after SetFlag")
+	}
+	if _, ok := store.Get("import:oc_1:ou_1"); ok {
+		t.Error("flag should not be stored as a session")
+	}
+	time.Sleep(time.Millisecond * 100)
+	if store.HasFlag("import:oc_1:ou_1") {
+		t.Error("HasFlag() = true after expiration")
+	}
+	store.SetFlag("import:oc_1:ou_1", time.Minute)
+	store.DeleteFlag("import:oc_1:ou_1")
+	if store.HasFlag("import:oc_1:ou_1") {
+		t.Error("HasFlag() = true after DeleteFlag")
+	}
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+	"unicode"
+)
+
+// 内置工具名
+const (
+	ToolCalculator  = "calculator"
+	ToolCurrentTime = "current_time"
+)
+
+// NewCalculatorTool 计算数学表达式，支持 + - * / % ^ 和括号
+func NewCalculatorTool() Tool {
+	return Tool{
+		Name:        ToolCalculator,
+		Description: "计算数学表达式，支持加减乘除、取余（%）、乘方（^）和括号，需要精确计算时使用",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"expression": {"type": "string", "description": "数学表达式，例如 (1 + 2) * 3 ^ 2"}
+			},
+			"required": ["expression"]
+		}`),
+		Handler: func(ctx context.Context, arguments string) (string, error) {
+			var args struct {
+				Expression string `json:"expression"`
+			}
+			if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+				return "", fmt.Errorf("invalid arguments: %w", err)
+			}
+			value, err := Calculate(args.Expression)
+			if err != nil {
+				return "", err
+			}
+			return formatNumber(value), nil
+		},
+	}
+}
+
+// NewCurrentTimeTool 查询当前时间，不指定时区时使用 defaultTimezone
+func NewCurrentTimeTool(defaultTimezone string) (Tool, error) {
+	if _, err := time.LoadLocation(defaultTimezone); err != nil {
+		return Tool{}, fmt.Errorf("invalid timezone: %w", err)
+	}
+	return Tool{
+		Name:        ToolCurrentTime,
+		Description: "查询当前的日期、时间和星期，可以指定时区",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"timezone": {"type": "string", "description": "IANA 时区名称，例如 Asia/Shanghai、America/New_York，不填时使用默认时区"}
+			}
+		}`),
+		Handler: func(ctx context.Context, arguments string) (string, error) {
+			var args struct {
+				Timezone string `json:"timezone"`
+			}
+			if arguments != "" {
+				if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+					return "", fmt.Errorf("invalid arguments: %w", err)
+				}
+			}
+			if args.Timezone == "" {
+				args.Timezone = defaultTimezone
+			}
+			loc, err := time.LoadLocation(args.Timezone)
+			if err != nil {
+				return "", fmt.Errorf("unknown timezone: %v", args.Timezone)
+			}
+			now := time.Now().In(loc)
+			result, err := json.Marshal(map[string]string{
+				"time":     now.Format(time.RFC3339),
+				"timezone": loc.String(),
+				"weekday":  now.Weekday().String(),
+			})
+			return string(result), err
+		},
+	}, nil
+}
+
+func formatNumber(v float64) string {
+	if math.Abs(v) < 1e15 {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Calculate 计算数学表达式
+func Calculate(expression string) (float64, error) {
+	p := &exprParser{input: []rune(expression)}
+	value, err := p.parseExpr()
+	if err != nil {
+		return 0, err
+	}
+	p.skipSpaces()
+	if p.pos < len(p.input) {
+		return 0, fmt.Errorf("unexpected %q at %d", p.input[p.pos], p.pos)
+	}
+	if math.IsInf(value, 0) || math.IsNaN(value) {
+		return 0, fmt.Errorf("result is not a finite number")
+	}
+	return value, nil
+}
+
+// exprParser 递归下降解析：expr = term {(+|-) term}，term = unary {(*|/|%) unary}，
+// unary = (-|+) unary | power，power = primary [^ unary]，primary = number | (expr)
+type exprParser struct {
+	input []rune
+	pos   int
+}
+
+func (p *exprParser) skipSpaces() {
+	for p.pos < len(p.input) && unicode.IsSpace(p.input[p.pos]) {
+		p.pos++
+	}
+}
+
+// next 跳过空白后返回下一个字符，到达末尾时返回 0
+func (p *exprParser) next() rune {
+	p.skipSpaces()
+	if p.pos < len(p.input) {
+		return p.input[p.pos]
+	}
+	return 0
+}
+
+func (p *exprParser) parseExpr() (float64, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := p.next()
+		if op != '+' && op != '-' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseTerm()
+		if err != nil {
+			return 0, err
+		}
+		if op == '+' {
+			left += right
+		} else {
+			left -= right
+		}
+	}
+}
+
+func (p *exprParser) parseTerm() (float64, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := p.next()
+		if op != '*' && op != '/' && op != '%' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case op == '*':
+			left *= right
+		case right == 0:
+			return 0, fmt.Errorf("division by zero")
+		case op == '/':
+			left /= right
+		default:
+			left = math.Mod(left, right)
+		}
+	}
+}
+
+func (p *exprParser) parseUnary() (float64, error) {
+	switch p.next() {
+	case '-':
+		p.pos++
+		value, err := p.parseUnary()
+		return -value, err
+	case '+':
+		p.pos++
+		return p.parseUnary()
+	}
+	return p.parsePower()
+}
+
+func (p *exprParser) parsePower() (float64, error) {
+	base, err := p.parsePrimary()
+	if err != nil {
+		return 0, err
+	}
+	if p.next() != '^' {
+		return base, nil
+	}
+	p.pos++
+	exponent, err := p.parseUnary()
+	if err != nil {
+		return 0, err
+	}
+	return math.Pow(base, exponent), nil
+}
+
+func (p *exprParser) parsePrimary() (float64, error) {
+	if p.next() == '(' {
+		p.pos++
+		value, err := p.parseExpr()
+		if err != nil {
+			return 0, err
+		}
+		if p.next() != ')' {
+			return 0, fmt.Errorf("missing ')' at %d", p.pos)
+		}
+		p.pos++
+		return value, nil
+	}
+	start := p.pos
+	for p.pos < len(p.input) && (p.input[p.pos] >= '0' && p.input[p.pos] <= '9' || p.input[p.pos] == '.') {
+		p.pos++
+	}
+	if start == p.pos {
+		if p.pos >= len(p.input) {
+			return 0, fmt.Errorf("unexpected end of expression")
+		}
+		return 0, fmt.Errorf("unexpected %q at %d", p.input[p.pos], p.pos)
+	}
+	return strconv.ParseFloat(string(p.input[start:p.pos]), 64)
+}
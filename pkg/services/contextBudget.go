@@ -0,0 +1,88 @@
+package services
+
+import (
+	"regexp"
+	"strconv"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const (
+	defaultContextWindow = 8192
+	// 每条消息除内容外的格式开销
+	tokensPerMessage = 4
+)
+
+// 各模型的上下文窗口大小
+var modelContextWindows = map[string]int{
+	"moonshot-v1-8k":   8192,
+	"moonshot-v1-32k":  32768,
+	"moonshot-v1-128k": 131072,
+	"moonshot-v1-auto": 131072,
+	"gpt-3.5-turbo":    16385,
+	"gpt-4":            8192,
+	"gpt-4-32k":        32768,
+	"gpt-4-turbo":      128000,
+	"gpt-4o":           128000,
+	"gpt-4o-mini":      128000,
+}
+
+var contextWindowSuffix = regexp.MustCompile(`-(\d+)k$`)
+
+// ContextWindow 返回模型的上下文窗口，未知模型按名称中的 -8k/-32k 后缀推断
+func ContextWindow(model string) int {
+	if window, ok := modelContextWindows[model]; ok {
+		return window
+	}
+	if matches := contextWindowSuffix.FindStringSubmatch(model); len(matches) > 1 {
+		if k, err := strconv.Atoi(matches[1]); err == nil && k > 0 {
+			return k * 1024
+		}
+	}
+	return defaultContextWindow
+}
+
+// ContextBudget 返回请求中上下文可用的 token 数，需要为回答预留 maxTokens
+func ContextBudget(model string, maxTokens int) int {
+	budget := ContextWindow(model) - maxTokens
+	if budget < 0 {
+		return 0
+	}
+	return budget
+}
+
+// FitContext 在请求前将上下文裁剪到预算内。
+// system 消息（系统提示词、文件内容）和最后一条消息始终保留，
+// 其余按轮次从最早的开始丢弃，返回保留的和被丢弃的消息。
+func FitContext(msgs []openai.ChatCompletionMessage, budget int) (kept, evicted []openai.ChatCompletionMessage) {
+	lengths := make([]int, len(msgs))
+	total := 0
+	for i, m := range msgs {
+		lengths[i] = CalculateTokenLength(m) + tokensPerMessage
+		total += lengths[i]
+	}
+
+	dropped := make([]bool, len(msgs))
+	for i := 0; i < len(msgs)-1 && total > budget; i++ {
+		if msgs[i].Role == openai.ChatMessageRoleSystem || dropped[i] {
+			continue
+		}
+		// 以一个用户提问及其后的回答为一轮整体丢弃
+		for j := i; j < len(msgs)-1; j++ {
+			if j > i && (msgs[j].Role == openai.ChatMessageRoleUser || msgs[j].Role == openai.ChatMessageRoleSystem) {
+				break
+			}
+			dropped[j] = true
+			total -= lengths[j]
+		}
+	}
+
+	for i, m := range msgs {
+		if dropped[i] {
+			evicted = append(evicted, m)
+		} else {
+			kept = append(kept, m)
+		}
+	}
+	return kept, evicted
+}
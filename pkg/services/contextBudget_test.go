@@ -0,0 +1,67 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestContextWindow(t *testing.T) {
+	tests := []struct {
+		name  string
+		model string
+		want  int
+	}{
+		{name: "known model", model: "moonshot-v1-128k", want: 131072},
+		{name: "suffix", model: "custom-model-16k", want: 16384},
+		{name: "unknown", model: "custom-model", want: defaultContextWindow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ContextWindow(tt.model); got != tt.want {
+				t.Errorf("ContextWindow() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFitContext(t *testing.T) {
+	long := strings.Repeat("hello ", 100)
+	msgs := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: "system prompt"},
+		{Role: openai.ChatMessageRoleSystem, Content: "file content " + long},
+		{Role: openai.ChatMessageRoleUser, Content: "q1 " + long},
+		{Role: openai.ChatMessageRoleAssistant, Content: "a1 " + long},
+		{Role: openai.ChatMessageRoleUser, Content: "q2"},
+		{Role: openai.ChatMessageRoleAssistant, Content: "a2"},
+		{Role: openai.ChatMessageRoleUser, Content: "q3"},
+	}
+
+	kept, evicted := FitContext(msgs, 10000)
+	if len(kept) != len(msgs) || len(evicted) != 0 {
+		t.Errorf("FitContext() within budget kept = %v, evicted = %v", len(kept), len(evicted))
+	}
+
+	// 预算只够 system 消息和最近几轮，最早的一轮被整体丢弃
+	budget := CalculateTokenLength(msgs[0]) + CalculateTokenLength(msgs[1]) + 60
+	kept, evicted = FitContext(msgs, budget)
+	want := []string{"system prompt", msgs[1].Content, "q2", "a2", "q3"}
+	if len(kept) != len(want) {
+		t.Fatalf("FitContext() kept = %v, want %v", len(kept), len(want))
+	}
+	for i, m := range kept {
+		if m.Content != want[i] {
+			t.Errorf("FitContext() kept[%d] = %v, want %v", i, m.Content, want[i])
+		}
+	}
+	if len(evicted) != 2 || evicted[0].Role != openai.ChatMessageRoleUser || evicted[1].Role != openai.ChatMessageRoleAssistant {
+		t.Errorf("FitContext() evicted = %+v, want q1/a1", evicted)
+	}
+
+	// 预算不足时也不丢弃 system 消息和最后的提问
+	kept, _ = FitContext(msgs, 0)
+	if len(kept) != 3 || kept[2].Content != "q3" {
+		t.Errorf("FitContext() with zero budget kept = %+v", kept)
+	}
+}
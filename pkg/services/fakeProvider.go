@@ -0,0 +1,232 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// FakeProvider 确定性的内存实现，用于离线测试。
+// 依次返回 Replies 中的回答，用完后回显最后一条用户消息。
+type FakeProvider struct {
+	Model     string
+	MaxTokens int
+	Replies   []string
+	// FinishReason 为空时返回 stop
+	FinishReason openai.FinishReason
+	// Err 不为空时所有对话请求都返回该错误
+	Err error
+	// ChunkSize 流式回答时每次发送的字符数
+	ChunkSize int
+	// ToolCalls 请求中带有 tools 且没有禁止调用时，依次返回其中的工具调用，用完后正常回答
+	ToolCalls [][]openai.ToolCall
+
+	mu       sync.Mutex
+	requests [][]openai.ChatCompletionMessage
+	toolReqs []FakeToolRequest
+	files    []fakeFile
+	nextId   int
+}
+
+// FakeToolRequest 带有 tools 的请求中的工具参数
+type FakeToolRequest struct {
+	Tools      int
+	ToolChoice string
+}
+
+type fakeFile struct {
+	file    openai.File
+	content []byte
+}
+
+var _ LLMProvider = (*FakeProvider)(nil)
+
+func NewFakeProvider(replies ...string) *FakeProvider {
+	return &FakeProvider{Model: "fake-8k", MaxTokens: 1000, Replies: replies, ChunkSize: 4}
+}
+
+func (f *FakeProvider) ModelOf(settings SessionSettings) string {
+	if settings.Model != "" {
+		return settings.Model
+	}
+	return f.Model
+}
+
+func (f *FakeProvider) MaxTokensOf(settings SessionSettings) int {
+	if settings.MaxTokens > 0 {
+		return settings.MaxTokens
+	}
+	return f.MaxTokens
+}
+
+// Requests 返回收到的所有对话请求
+func (f *FakeProvider) Requests() [][]openai.ChatCompletionMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([][]openai.ChatCompletionMessage(nil), f.requests...)
+}
+
+// ToolRequests 返回带有 tools 的请求中的工具参数
+func (f *FakeProvider) ToolRequests() []FakeToolRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]FakeToolRequest(nil), f.toolReqs...)
+}
+
+func (f *FakeProvider) reply(msgs []openai.ChatCompletionMessage) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, append([]openai.ChatCompletionMessage(nil), msgs...))
+	if f.Err != nil {
+		return "", f.Err
+	}
+	if len(f.Replies) > 0 {
+		reply := f.Replies[0]
+		f.Replies = f.Replies[1:]
+		return reply, nil
+	}
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].Role == openai.ChatMessageRoleUser {
+			return msgs[i].Content, nil
+		}
+	}
+	return "", nil
+}
+
+func (f *FakeProvider) Completions(ctx context.Context, msgs []openai.ChatCompletionMessage, settings SessionSettings) (openai.ChatCompletionMessage, error) {
+	reply, err := f.reply(msgs)
+	if err != nil {
+		return openai.ChatCompletionMessage{}, err
+	}
+	return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: reply}, nil
+}
+
+func (f *FakeProvider) StreamChat(ctx context.Context, msgs []openai.ChatCompletionMessage, settings SessionSettings, responseStream chan<- string) (openai.FinishReason, error) {
+	finishReason, _, err := f.StreamChatTools(ctx, msgs, settings, nil, "", responseStream)
+	return finishReason, err
+}
+
+// toolCalls 返回下一组工具调用，没有时返回 nil
+func (f *FakeProvider) toolCalls(msgs []openai.ChatCompletionMessage) []openai.ToolCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil || len(f.ToolCalls) == 0 {
+		return nil
+	}
+	calls := f.ToolCalls[0]
+	f.ToolCalls = f.ToolCalls[1:]
+	f.requests = append(f.requests, append([]openai.ChatCompletionMessage(nil), msgs...))
+	return calls
+}
+
+func (f *FakeProvider) StreamChatTools(ctx context.Context, msgs []openai.ChatCompletionMessage, settings SessionSettings, tools []openai.Tool, toolChoice string, responseStream chan<- string) (openai.FinishReason, []openai.ToolCall, error) {
+	defer close(responseStream)
+	if len(tools) > 0 {
+		f.mu.Lock()
+		f.toolReqs = append(f.toolReqs, FakeToolRequest{Tools: len(tools), ToolChoice: toolChoice})
+		f.mu.Unlock()
+	}
+	if len(tools) > 0 && toolChoice != ToolChoiceNone {
+		if calls := f.toolCalls(msgs); calls != nil {
+			return openai.FinishReasonToolCalls, calls, nil
+		}
+	}
+	reply, err := f.reply(msgs)
+	if err != nil {
+		return "", nil, err
+	}
+	size := f.ChunkSize
+	if size <= 0 {
+		size = len(reply)
+	}
+	runes := []rune(reply)
+	for start := 0; start < len(runes); start += size {
+		end := min(start+size, len(runes))
+		select {
+		case responseStream <- string(runes[start:end]):
+		case <-ctx.Done():
+			return "", nil, ctx.Err()
+		}
+	}
+	if f.FinishReason != "" {
+		return f.FinishReason, nil, nil
+	}
+	return openai.FinishReasonStop, nil, nil
+}
+
+func (f *FakeProvider) CreateFile(ctx context.Context, filePath string) (*openai.File, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextId++
+	file := openai.File{
+		ID:        fmt.Sprintf("file-%d", f.nextId),
+		Object:    "file",
+		Bytes:     len(content),
+		CreatedAt: time.Now().Unix(),
+		FileName:  filepath.Base(filePath),
+		Purpose:   "file-extract",
+		Status:    "ok",
+	}
+	f.files = append(f.files, fakeFile{file: file, content: content})
+	return &file, nil
+}
+
+func (f *FakeProvider) ListFiles(ctx context.Context) (*openai.FilesList, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	files := &openai.FilesList{}
+	for _, file := range f.files {
+		files.Files = append(files.Files, file.file)
+	}
+	return files, nil
+}
+
+func (f *FakeProvider) DeleteFile(ctx context.Context, fileID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, file := range f.files {
+		if file.file.ID == fileID {
+			f.files = append(f.files[:i], f.files[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("file not found: %s", fileID)
+}
+
+func (f *FakeProvider) findFile(fileID string) (fakeFile, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, file := range f.files {
+		if file.file.ID == fileID {
+			return file, nil
+		}
+	}
+	return fakeFile{}, fmt.Errorf("file not found: %s", fileID)
+}
+
+func (f *FakeProvider) GetFile(ctx context.Context, fileID string) (*openai.File, error) {
+	file, err := f.findFile(fileID)
+	if err != nil {
+		return nil, err
+	}
+	return &file.file, nil
+}
+
+func (f *FakeProvider) GetFileContent(ctx context.Context, fileID string) (io.ReadCloser, error) {
+	file, err := f.findFile(fileID)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(file.content)), nil
+}
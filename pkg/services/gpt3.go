@@ -3,14 +3,18 @@ package services
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"math"
+	"net/http"
 
 	openai "github.com/sashabaranov/go-openai"
 	"go.uber.org/zap"
 )
 
 type ChatGPT struct {
-	ApiKey    string
+	Keys      *KeyPool
+	Retry     RetryPolicy
 	ApiUrl    string
 	Model     string
 	MaxTokens int
@@ -18,16 +22,79 @@ type ChatGPT struct {
 	Logger    *zap.Logger
 }
 
-func (gpt *ChatGPT) Completions(ctx context.Context, msg []openai.ChatCompletionMessage) (openai.ChatCompletionMessage, error) {
-	resp, err := gpt.Client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
-		Model:            gpt.Model,
-		Messages:         msg,
-		MaxTokens:        gpt.MaxTokens,
-		TopP:             1,
-		FrequencyPenalty: 0,
-		PresencePenalty:  0,
-	},
-	)
+// NewChatGPT 使用模型配置创建兼容 OpenAI 接口的客户端，请求时从 key 池中选择 key，
+// 失败时按 profile.Retry 重试
+func NewChatGPT(profile ModelProfile, logger *zap.Logger) (*ChatGPT, error) {
+	keys, err := NewKeyPool(profile.ApiKeys, profile.KeyStrategy, profile.KeyCooldown)
+	if err != nil {
+		return nil, fmt.Errorf("model profile %s: %w", profile.Name, err)
+	}
+	config := openai.DefaultConfig("")
+	config.BaseURL = profile.ApiUrl
+	retry := profile.Retry.withDefaults()
+	config.HTTPClient = &http.Client{
+		Transport: &retryTransport{
+			policy: retry,
+			base:   &keyPoolTransport{pool: keys, base: http.DefaultTransport, logger: logger},
+			logger: logger,
+		},
+	}
+	return &ChatGPT{
+		Keys:      keys,
+		Retry:     retry,
+		ApiUrl:    profile.ApiUrl,
+		Model:     profile.Model,
+		MaxTokens: profile.MaxTokens,
+		Client:    openai.NewClientWithConfig(config),
+		Logger:    logger,
+	}, nil
+}
+
+func (gpt *ChatGPT) KeyStats() []KeyStat {
+	return gpt.Keys.Stats()
+}
+
+// ModelOf 返回会话实际使用的模型
+func (gpt *ChatGPT) ModelOf(settings SessionSettings) string {
+	if settings.Model != "" {
+		return settings.Model
+	}
+	return gpt.Model
+}
+
+// MaxTokensOf 返回会话实际使用的 max_tokens
+func (gpt *ChatGPT) MaxTokensOf(settings SessionSettings) int {
+	if settings.MaxTokens > 0 {
+		return settings.MaxTokens
+	}
+	return gpt.MaxTokens
+}
+
+func (gpt *ChatGPT) newRequest(msgs []openai.ChatCompletionMessage, settings SessionSettings) openai.ChatCompletionRequest {
+	req := openai.ChatCompletionRequest{
+		Model:     gpt.ModelOf(settings),
+		Messages:  msgs,
+		MaxTokens: gpt.MaxTokensOf(settings),
+	}
+	// go-openai 会忽略零值，用最小正数表示 0
+	if settings.Temperature != nil {
+		req.Temperature = nonZero(*settings.Temperature)
+	}
+	if settings.TopP != nil {
+		req.TopP = nonZero(*settings.TopP)
+	}
+	return req
+}
+
+func nonZero(f float32) float32 {
+	if f == 0 {
+		return math.SmallestNonzeroFloat32
+	}
+	return f
+}
+
+func (gpt *ChatGPT) Completions(ctx context.Context, msg []openai.ChatCompletionMessage, settings SessionSettings) (openai.ChatCompletionMessage, error) {
+	resp, err := gpt.Client.CreateChatCompletion(ctx, gpt.newRequest(msg, settings))
 
 	if err != nil {
 		gpt.Logger.Error("ChatCompletion error", zap.Error(err))
@@ -37,33 +104,64 @@ func (gpt *ChatGPT) Completions(ctx context.Context, msg []openai.ChatCompletion
 	return resp.Choices[0].Message, nil
 }
 
-func (gpt *ChatGPT) StreamChat(ctx context.Context, msgs []openai.ChatCompletionMessage, responseStream chan<- string) error {
+func (gpt *ChatGPT) StreamChat(ctx context.Context, msgs []openai.ChatCompletionMessage, settings SessionSettings, responseStream chan<- string) (openai.FinishReason, error) {
+	finishReason, _, err := gpt.StreamChatTools(ctx, msgs, settings, nil, "", responseStream)
+	return finishReason, err
+}
+
+func (gpt *ChatGPT) StreamChatTools(ctx context.Context, msgs []openai.ChatCompletionMessage, settings SessionSettings, tools []openai.Tool, toolChoice string, responseStream chan<- string) (openai.FinishReason, []openai.ToolCall, error) {
 	defer close(responseStream)
-	req := openai.ChatCompletionRequest{
-		Model:     gpt.Model,
-		Messages:  msgs,
-		MaxTokens: 2000,
-		Stream:    true,
+	req := gpt.newRequest(msgs, settings)
+	req.Stream = true
+	req.Tools = tools
+	if toolChoice != "" {
+		req.ToolChoice = toolChoice
+	}
+	// 建立连接时的失败由 retryTransport 重试，这里只重试连接建立后、返回第一个字之前的中断
+	for attempt := 1; ; attempt++ {
+		finishReason, toolCalls, retryable, err := gpt.streamOnce(ctx, req, responseStream)
+		if err == nil || !retryable || attempt >= gpt.Retry.MaxAttempts || ctx.Err() != nil {
+			return finishReason, toolCalls, err
+		}
+		delay := gpt.Retry.Backoff(attempt, 0)
+		gpt.Logger.Warn("stream retry", zap.Int("attempt", attempt), zap.Duration("delay", delay), zap.Error(err))
+		if err := sleep(ctx, delay); err != nil {
+			return "", nil, err
+		}
 	}
+}
+
+// streamOnce 请求一次流式回答，retryable 表示连接已建立但还没有返回任何内容
+func (gpt *ChatGPT) streamOnce(ctx context.Context, req openai.ChatCompletionRequest, responseStream chan<- string) (
+	finishReason openai.FinishReason, toolCalls []openai.ToolCall, retryable bool, err error) {
 	stream, err := gpt.Client.CreateChatCompletionStream(ctx, req)
 	if err != nil {
 		gpt.Logger.Error("ChatCompletionStream error", zap.Error(err))
-		return err
+		return "", nil, false, err
 	}
 	defer stream.Close()
 
+	received := false
 	for {
 		response, err := stream.Recv()
 		if errors.Is(err, io.EOF) {
-			return nil
+			return finishReason, toolCalls, false, nil
 		}
 		if err != nil {
 			gpt.Logger.Error("Stream error", zap.Error(err))
-			return err
+			return finishReason, nil, !received, err
 		}
 		if len(response.Choices) > 0 {
-			responseStream <- response.Choices[0].Delta.Content
-			gpt.Logger.Debug("response", zap.String("content", response.Choices[0].Delta.Content))
+			choice := response.Choices[0]
+			if choice.FinishReason != "" {
+				finishReason = choice.FinishReason
+			}
+			if choice.Delta.Content != "" || len(choice.Delta.ToolCalls) > 0 {
+				received = true
+			}
+			toolCalls = mergeToolCallDeltas(toolCalls, choice.Delta.ToolCalls)
+			responseStream <- choice.Delta.Content
+			gpt.Logger.Debug("response", zap.String("content", choice.Delta.Content))
 		}
 
 	}
@@ -117,7 +215,7 @@ func (gpt *ChatGPT) GetFile(ctx context.Context, fileID string) (*openai.File, e
 	return &file, nil
 }
 
-func (gpt *ChatGPT) GetFileContent(ctx context.Context, fileID string) (*openai.RawResponse, error) {
+func (gpt *ChatGPT) GetFileContent(ctx context.Context, fileID string) (io.ReadCloser, error) {
 	file, err := gpt.Client.GetFileContent(ctx, fileID)
 
 	if err != nil {
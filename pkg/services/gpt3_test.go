@@ -0,0 +1,72 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestStreamChatFinishReason(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		want   openai.FinishReason
+	}{
+		{name: "正常结束", chunks: []string{`{"choices":[{"delta":{"content":"你好"},"finish_reason":"stop"}]}`}, want: openai.FinishReasonStop},
+		{name: "长度截断", chunks: []string{
+			`{"choices":[{"delta":{"content":"很长的"}}]}`,
+			`{"choices":[{"delta":{"content":"回答"},"finish_reason":"length"}]}`,
+		}, want: openai.FinishReasonLength},
+		{name: "结束原因在最后的空内容中", chunks: []string{
+			`{"choices":[{"delta":{"content":"回答"}}]}`,
+			`{"choices":[{"delta":{},"finish_reason":"length"}]}`,
+		}, want: openai.FinishReasonLength},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gpt, _ := failingServer(t, 0, nil, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				for _, chunk := range tt.chunks {
+					w.Write([]byte("data: " + chunk + "\n\n"))
+				}
+				w.Write([]byte("data: [DONE]\n\n"))
+			})
+			stream := make(chan string)
+			go func() {
+				for range stream {
+				}
+			}()
+			got, err := gpt.StreamChat(context.Background(), []openai.ChatCompletionMessage{
+				{Role: openai.ChatMessageRoleUser, Content: "hi"},
+			}, SessionSettings{}, stream)
+			if err != nil || got != tt.want {
+				t.Errorf("StreamChat() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamChatToolCalls(t *testing.T) {
+	gpt, _ := failingServer(t, 0, nil, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(`data: {"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call-1","type":"function","function":{"name":"calculator","arguments":""}}]}}]}` + "\n\n"))
+		w.Write([]byte(`data: {"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"expression\":\"1+1\"}"}}]},"finish_reason":"tool_calls"}]}` + "\n\n"))
+		w.Write([]byte("data: [DONE]\n\n"))
+	})
+	stream := make(chan string)
+	go func() {
+		for range stream {
+		}
+	}()
+	finishReason, calls, err := gpt.StreamChatTools(context.Background(), []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleUser, Content: "1+1"},
+	}, SessionSettings{}, NewToolRegistry(nil).Definitions(), "", stream)
+	if err != nil || finishReason != openai.FinishReasonToolCalls {
+		t.Fatalf("StreamChatTools() = %v, %v", finishReason, err)
+	}
+	if len(calls) != 1 || calls[0].ID != "call-1" || calls[0].Function.Arguments != `{"expression":"1+1"}` {
+		t.Errorf("tool calls = %+v", calls)
+	}
+}
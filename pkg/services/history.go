@@ -0,0 +1,68 @@
+package services
+
+import (
+	"log"
+	"sort"
+	"time"
+)
+
+const (
+	// 每个用户保留的话题数
+	maxHistoryEntries = 20
+	historyExpiration = time.Hour * 24 * 30
+	// 与会话锁共用存储的锁，加前缀避免和话题 id 冲突
+	historyLockPrefix = "history:"
+)
+
+// HistoryEntry 用户话题索引中的一项
+type HistoryEntry struct {
+	SessionId    string    `json:"session_id"` // 话题的根消息
+	ChatId       string    `json:"chat_id"`
+	ChatType     string    `json:"chat_type,omitempty"`
+	Question     string    `json:"question"` // 话题的第一个问题
+	LastActiveAt time.Time `json:"last_active_at"`
+	MessageCount int       `json:"message_count"`
+}
+
+// RecordHistory 更新用户的话题索引，最近活跃的排在前面。
+// 同一用户的更新按用户加锁串行执行，内存存储返回的是共享的切片，修改前先复制
+func (s *SessionService) RecordHistory(userId string, entry HistoryEntry) {
+	unlock, err := s.store.Lock(historyLockPrefix + userId)
+	if err != nil {
+		log.Printf("lock history %s error: %v", userId, err)
+		return
+	}
+	defer unlock()
+	history := append([]HistoryEntry(nil), s.store.GetHistory(userId)...)
+	found := false
+	for i := range history {
+		if history[i].SessionId == entry.SessionId {
+			// 保留第一个问题
+			entry.Question = history[i].Question
+			history[i] = entry
+			found = true
+			break
+		}
+	}
+	if !found {
+		history = append(history, entry)
+	}
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].LastActiveAt.After(history[j].LastActiveAt)
+	})
+	if len(history) > maxHistoryEntries {
+		history = history[:maxHistoryEntries]
+	}
+	s.store.SetHistory(userId, history, historyExpiration)
+}
+
+// GetHistory 返回用户在 chatId 中仍然有效的话题，避免在群聊中展示单聊的问题
+func (s *SessionService) GetHistory(userId string, chatId string) []HistoryEntry {
+	var history []HistoryEntry
+	for _, entry := range s.store.GetHistory(userId) {
+		if entry.ChatId == chatId && s.Exists(entry.SessionId) {
+			history = append(history, entry)
+		}
+	}
+	return history
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestGetHistoryFiltersChat(t *testing.T) {
+	s := &SessionService{store: NewMemoryStore()}
+	for _, entry := range []HistoryEntry{
+		{SessionId: "om_p2p", ChatId: "oc_p2p", Question: "单聊的问题"},
+		{SessionId: "om_group", ChatId: "oc_group", Question: "群聊的问题"},
+	} {
+		s.SetMsg(entry.SessionId, []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: entry.Question}})
+		s.RecordHistory("ou_1", entry)
+	}
+	history := s.GetHistory("ou_1", "oc_group")
+	if len(history) != 1 || history[0].SessionId != "om_group" {
+		t.Errorf("GetHistory() = %+v, want only om_group", history)
+	}
+}
+
+func TestRecordHistoryConcurrent(t *testing.T) {
+	s := &SessionService{store: NewMemoryStore()}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		sessionId := fmt.Sprintf("om_%d", i)
+		s.SetMsg(sessionId, []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.RecordHistory("ou_1", HistoryEntry{SessionId: sessionId, ChatId: "oc_1"})
+		}()
+	}
+	wg.Wait()
+	if got := len(s.GetHistory("ou_1", "oc_1")); got != 10 {
+		t.Errorf("GetHistory() = %d entries, want 10", got)
+	}
+}
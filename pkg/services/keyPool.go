@@ -0,0 +1,231 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// 选择 key 的策略
+const (
+	KeyStrategyRoundRobin   = "round_robin"
+	KeyStrategyLeastLimited = "least_limited"
+)
+
+const defaultKeyCooldown = time.Minute
+
+// KeyPool 多个 API key 轮流使用，被限流的 key 冷却一段时间后再使用
+type KeyPool struct {
+	mu       sync.Mutex
+	keys     []*poolKey
+	strategy string
+	cooldown time.Duration
+	next     int
+	now      func() time.Time
+}
+
+type poolKey struct {
+	key           string
+	requests      int
+	limited       int
+	lastLimitedAt time.Time
+	coolingUntil  time.Time
+}
+
+// KeyStat key 的使用情况，key 只展示首尾几位
+type KeyStat struct {
+	Key           string    `json:"key"`
+	Requests      int       `json:"requests"`
+	Limited       int       `json:"limited"`
+	LastLimitedAt time.Time `json:"last_limited_at,omitempty"`
+	CoolingUntil  time.Time `json:"cooling_until,omitempty"`
+}
+
+func NewKeyPool(keys []string, strategy string, cooldown time.Duration) (*KeyPool, error) {
+	switch strategy {
+	case "":
+		strategy = KeyStrategyRoundRobin
+	case KeyStrategyRoundRobin, KeyStrategyLeastLimited:
+	default:
+		return nil, fmt.Errorf("unknown key strategy: %v", strategy)
+	}
+	if cooldown <= 0 {
+		cooldown = defaultKeyCooldown
+	}
+	pool := &KeyPool{strategy: strategy, cooldown: cooldown, now: time.Now}
+	seen := map[string]bool{}
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		pool.keys = append(pool.keys, &poolKey{key: key})
+	}
+	if len(pool.keys) == 0 {
+		return nil, fmt.Errorf("api key is required")
+	}
+	return pool, nil
+}
+
+func (p *KeyPool) Len() int {
+	return len(p.keys)
+}
+
+// Pick 选择一个 key，跳过冷却中和 exclude 中的 key。
+// 全部冷却时返回最早结束冷却的 key；全部被排除时返回 false。
+func (p *KeyPool) Pick(exclude map[string]bool) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	var picked, earliest *poolKey
+	for i := range p.keys {
+		k := p.keys[(p.next+i)%len(p.keys)]
+		if exclude[k.key] {
+			continue
+		}
+		if k.coolingUntil.After(now) {
+			if earliest == nil || k.coolingUntil.Before(earliest.coolingUntil) {
+				earliest = k
+			}
+			continue
+		}
+		if picked == nil {
+			picked = k
+			if p.strategy == KeyStrategyRoundRobin {
+				break
+			}
+		} else if k.lastLimitedAt.Before(picked.lastLimitedAt) {
+			picked = k
+		}
+	}
+	if picked == nil {
+		picked = earliest
+	}
+	if picked == nil {
+		return "", false
+	}
+	for i, k := range p.keys {
+		if k == picked {
+			p.next = (i + 1) % len(p.keys)
+		}
+	}
+	picked.requests++
+	return picked.key, true
+}
+
+// MarkLimited key 被限流时进入冷却，retryAfter 大于默认冷却时间时以 retryAfter 为准
+func (p *KeyPool) MarkLimited(key string, retryAfter time.Duration) time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	cooldown := max(p.cooldown, retryAfter)
+	now := p.now()
+	for _, k := range p.keys {
+		if k.key == key {
+			k.limited++
+			k.lastLimitedAt = now
+			k.coolingUntil = now.Add(cooldown)
+		}
+	}
+	return cooldown
+}
+
+func (p *KeyPool) Stats() []KeyStat {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	stats := make([]KeyStat, 0, len(p.keys))
+	for _, k := range p.keys {
+		stat := KeyStat{
+			Key:           MaskKey(k.key),
+			Requests:      k.requests,
+			Limited:       k.limited,
+			LastLimitedAt: k.lastLimitedAt,
+		}
+		if k.coolingUntil.After(now) {
+			stat.CoolingUntil = k.coolingUntil
+		}
+		stats = append(stats, stat)
+	}
+	return stats
+}
+
+// MaskKey 隐藏 key 的中间部分，用于日志和管理接口
+func MaskKey(key string) string {
+	if len(key) <= 10 {
+		return strings.Repeat("*", len(key))
+	}
+	return key[:5] + "..." + key[len(key)-4:]
+}
+
+// keyPoolTransport 为每个请求从 KeyPool 中选择 key，被限流时换一个 key 重新请求
+type keyPoolTransport struct {
+	pool   *KeyPool
+	base   http.RoundTripper
+	logger *zap.Logger
+}
+
+func (t *keyPoolTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	tried := map[string]bool{}
+	for {
+		key, ok := t.pool.Pick(tried)
+		if !ok {
+			return nil, fmt.Errorf("no api key available")
+		}
+		tried[key] = true
+		attempt, err := replayRequest(req, len(tried) > 1)
+		if err != nil {
+			return nil, err
+		}
+		attempt.Header.Set("Authorization", "Bearer "+key)
+		resp, err := t.base.RoundTrip(attempt)
+		if err != nil || !isKeyLimited(resp) {
+			return resp, err
+		}
+		cooldown := t.pool.MarkLimited(key, retryAfter(resp))
+		if t.logger != nil {
+			t.logger.Warn("api key limited",
+				zap.String("key", MaskKey(key)), zap.Int("status", resp.StatusCode), zap.Duration("cooldown", cooldown))
+		}
+		if len(tried) >= t.pool.Len() {
+			return resp, nil
+		}
+		resp.Body.Close()
+	}
+}
+
+// isKeyLimited 429 或额度不足
+func isKeyLimited(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusPaymentRequired, http.StatusForbidden:
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		return strings.Contains(strings.ToLower(string(body)), "quota")
+	}
+	return false
+}
+
+// retryAfter 解析 Retry-After 响应头，支持秒数和 HTTP 日期
+func retryAfter(resp *http.Response) time.Duration {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
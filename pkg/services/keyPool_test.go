@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestKeyPoolPick(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		strategy string
+		limited  []string
+		want     []string
+	}{
+		{name: "轮询", strategy: KeyStrategyRoundRobin, want: []string{"a", "b", "c", "a"}},
+		{name: "跳过冷却中的 key", strategy: KeyStrategyRoundRobin, limited: []string{"b"}, want: []string{"a", "c", "a"}},
+		{name: "全部冷却时使用最早结束冷却的 key", strategy: KeyStrategyRoundRobin, limited: []string{"a", "b", "c"}, want: []string{"a"}},
+		{name: "优先最久未被限流的 key", strategy: KeyStrategyLeastLimited, want: []string{"a", "b", "c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool, err := NewKeyPool([]string{"a", "b", "c", "a"}, tt.strategy, time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pool.now = func() time.Time { return now }
+			for i, key := range tt.limited {
+				pool.now = func() time.Time { return now.Add(time.Duration(i) * time.Second) }
+				pool.MarkLimited(key, 0)
+			}
+			pool.now = func() time.Time { return now.Add(10 * time.Second) }
+			for i, want := range tt.want {
+				if got, _ := pool.Pick(nil); got != want {
+					t.Errorf("Pick() #%d = %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestKeyPoolLeastLimited(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	pool, _ := NewKeyPool([]string{"a", "b"}, KeyStrategyLeastLimited, time.Minute)
+	pool.now = func() time.Time { return now }
+	pool.MarkLimited("a", 0)
+	pool.now = func() time.Time { return now.Add(30 * time.Second) }
+	pool.MarkLimited("b", 0)
+	// 两个 key 都已结束冷却，a 被限流的时间更早
+	pool.now = func() time.Time { return now.Add(2 * time.Minute) }
+	for i := 0; i < 2; i++ {
+		if got, _ := pool.Pick(nil); got != "a" {
+			t.Errorf("Pick() = %v, want a", got)
+		}
+	}
+}
+
+func TestKeyPoolTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Bearer sk-limited" {
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error":{"message":"rate limit"}}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`))
+	}))
+	defer server.Close()
+
+	gpt, err := NewChatGPT(ModelProfile{
+		Name:    DefaultProfile,
+		ApiUrl:  server.URL,
+		ApiKeys: []string{"sk-limited", "sk-available"},
+		Model:   "test-model",
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		got, err := gpt.Completions(context.Background(), []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleUser, Content: "hi"},
+		}, SessionSettings{})
+		if err != nil {
+			t.Fatalf("Completions() error = %v", err)
+		}
+		if got.Content != "ok" {
+			t.Errorf("Completions() = %v, want ok", got.Content)
+		}
+	}
+	stats := gpt.KeyStats()
+	if stats[0].Limited != 1 || stats[0].CoolingUntil.IsZero() {
+		t.Errorf("limited key stat = %+v, want limited once and cooling", stats[0])
+	}
+	if stats[1].Requests != 2 {
+		t.Errorf("available key requests = %v, want 2", stats[1].Requests)
+	}
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultSystemPrompt 未配置 SYSTEM_PROMPT 时使用的系统提示词模板
+const DefaultSystemPrompt = `你是 Kimi，由 Moonshot AI 提供的人工智能助手，你更擅长中文和英文的对话。你会为用户提供安全，有帮助，准确的回答。同时，你会拒绝一切涉及恐怖主义，种族歧视，黄色暴力等问题的回答。Moonshot AI 为专有名词，不可翻译成其他语言。
+我的名字是{{.UserName}}, 请使用这个名字和我交流。`
+
+// PromptVars 系统提示词模板中可用的变量
+type PromptVars struct {
+	UserName   string
+	Department string
+	ChatName   string
+	Date       string
+	Time       string
+	Timezone   string
+}
+
+type promptTemplate struct {
+	text string
+	tmpl *template.Template
+}
+
+// PromptTemplates 系统提示词模板，可以按会话单独配置
+type PromptTemplates struct {
+	defaultPrompt promptTemplate
+	chatPrompts   map[string]promptTemplate
+	location      *time.Location
+}
+
+// NewPromptTemplates 解析并校验模板，defaultPrompt 为空时使用 DefaultSystemPrompt
+func NewPromptTemplates(defaultPrompt string, chatPrompts map[string]string, timezone string) (*PromptTemplates, error) {
+	if strings.TrimSpace(defaultPrompt) == "" {
+		defaultPrompt = DefaultSystemPrompt
+	}
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("load timezone %s: %w", timezone, err)
+	}
+	p := &PromptTemplates{chatPrompts: map[string]promptTemplate{}, location: location}
+	if p.defaultPrompt, err = parsePrompt("default", defaultPrompt); err != nil {
+		return nil, err
+	}
+	for chatId, text := range chatPrompts {
+		// viper 读取配置时会将 key 转为小写
+		chatId = strings.ToLower(chatId)
+		if p.chatPrompts[chatId], err = parsePrompt(chatId, text); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func parsePrompt(name string, text string) (promptTemplate, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return promptTemplate{}, fmt.Errorf("parse system prompt %s: %w", name, err)
+	}
+	// 提前执行一次，发现引用了不存在的变量
+	if err := tmpl.Execute(&bytes.Buffer{}, PromptVars{}); err != nil {
+		return promptTemplate{}, fmt.Errorf("check system prompt %s: %w", name, err)
+	}
+	return promptTemplate{text: text, tmpl: tmpl}, nil
+}
+
+// Vars 按配置的时区填充日期和时间
+func (p *PromptTemplates) Vars(now time.Time) PromptVars {
+	now = now.In(p.location)
+	return PromptVars{
+		Date:     now.Format("2006-01-02"),
+		Time:     now.Format("15:04"),
+		Timezone: p.location.String(),
+	}
+}
+
+func (p *PromptTemplates) prompt(chatId string) promptTemplate {
+	if prompt, ok := p.chatPrompts[strings.ToLower(chatId)]; ok {
+		return prompt
+	}
+	return p.defaultPrompt
+}
+
+// Uses 判断会话的模板是否引用了某个变量，用于跳过不必要的查询
+func (p *PromptTemplates) Uses(chatId string, name string) bool {
+	return strings.Contains(p.prompt(chatId).text, "."+name)
+}
+
+// Render 渲染会话的系统提示词
+func (p *PromptTemplates) Render(chatId string, vars PromptVars) (string, error) {
+	var buf bytes.Buffer
+	if err := p.prompt(chatId).tmpl.Execute(&buf, vars); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPromptTemplates(t *testing.T) {
+	prompts, err := NewPromptTemplates("", map[string]string{
+		"OC_Group": "你在{{.ChatName}}群中，今天是{{.Date}}（{{.Timezone}}），提问的是{{.Department}}的{{.UserName}}",
+	}, "Asia/Shanghai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := prompts.Vars(time.Date(2024, 6, 1, 20, 0, 0, 0, time.UTC))
+	vars.UserName, vars.Department, vars.ChatName = "张三", "研发部", "技术交流"
+
+	got, err := prompts.Render("oc_other", vars)
+	if err != nil || !strings.Contains(got, "我的名字是张三") {
+		t.Errorf("Render() default = %q, %v", got, err)
+	}
+	got, err = prompts.Render("oc_group", vars)
+	want := "你在技术交流群中，今天是2024-06-02（Asia/Shanghai），提问的是研发部的张三"
+	if err != nil || got != want {
+		t.Errorf("Render() chat = %q, %v, want %q", got, err, want)
+	}
+	if prompts.Uses("oc_other", "ChatName") || !prompts.Uses("oc_group", "ChatName") {
+		t.Error("Uses() mismatch")
+	}
+
+	if _, err := NewPromptTemplates("{{.Unknown}}", nil, ""); err == nil {
+		t.Error("NewPromptTemplates() want error for unknown variable")
+	}
+	if _, err := NewPromptTemplates("{{.UserName", nil, ""); err == nil {
+		t.Error("NewPromptTemplates() want error for invalid template")
+	}
+	if _, err := NewPromptTemplates("", nil, "Mars/Base"); err == nil {
+		t.Error("NewPromptTemplates() want error for unknown timezone")
+	}
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// LLMProvider 大模型服务的抽象，新的后端只需实现该接口
+type LLMProvider interface {
+	// ModelOf 返回会话实际使用的模型
+	ModelOf(settings SessionSettings) string
+	// MaxTokensOf 返回会话实际使用的 max_tokens
+	MaxTokensOf(settings SessionSettings) int
+
+	Completions(ctx context.Context, msgs []openai.ChatCompletionMessage, settings SessionSettings) (openai.ChatCompletionMessage, error)
+	// StreamChat 流式请求回答，结束后关闭 responseStream，并返回回答结束的原因
+	StreamChat(ctx context.Context, msgs []openai.ChatCompletionMessage, settings SessionSettings, responseStream chan<- string) (openai.FinishReason, error)
+	// StreamChatTools 与 StreamChat 相同，同时允许模型调用 tools，返回模型要求的工具调用，
+	// toolChoice 为空时由模型决定是否调用
+	StreamChatTools(ctx context.Context, msgs []openai.ChatCompletionMessage, settings SessionSettings, tools []openai.Tool, toolChoice string, responseStream chan<- string) (openai.FinishReason, []openai.ToolCall, error)
+
+	CreateFile(ctx context.Context, filePath string) (*openai.File, error)
+	ListFiles(ctx context.Context) (*openai.FilesList, error)
+	DeleteFile(ctx context.Context, fileID string) error
+	GetFile(ctx context.Context, fileID string) (*openai.File, error)
+	GetFileContent(ctx context.Context, fileID string) (io.ReadCloser, error)
+}
+
+var _ LLMProvider = (*ChatGPT)(nil)
+
+// ContextBudgetOf 返回会话请求中上下文可用的 token 数
+func ContextBudgetOf(llm LLMProvider, settings SessionSettings) int {
+	return ContextBudget(llm.ModelOf(settings), llm.MaxTokensOf(settings))
+}
+
+// CheckSettings 校验会话设置，max_tokens 必须小于模型的上下文窗口，否则没有空间放上下文
+func CheckSettings(llm LLMProvider, settings SessionSettings) error {
+	model, maxTokens := llm.ModelOf(settings), llm.MaxTokensOf(settings)
+	if window := ContextWindow(model); maxTokens >= window {
+		return fmt.Errorf("max_tokens %d should be less than the context window of %s (%d)", maxTokens, model, window)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestFakeProviderStreamChat(t *testing.T) {
+	fake := NewFakeProvider("你好，我是 Kimi")
+	stream := make(chan string)
+	var finishReason openai.FinishReason
+	var err error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		finishReason, err = fake.StreamChat(context.Background(), []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleUser, Content: "hi"},
+		}, SessionSettings{}, stream)
+	}()
+	var chunks []string
+	for chunk := range stream {
+		chunks = append(chunks, chunk)
+	}
+	<-done
+	if strings.Join(chunks, "") != "你好，我是 Kimi" || len(chunks) != 3 {
+		t.Errorf("StreamChat() chunks = %q", chunks)
+	}
+	if err != nil || finishReason != openai.FinishReasonStop {
+		t.Errorf("StreamChat() = %v, %v", finishReason, err)
+	}
+
+	// 回答用完后回显用户消息
+	reply, _ := fake.Completions(context.Background(), []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleUser, Content: "echo"},
+	}, SessionSettings{})
+	if reply.Content != "echo" || len(fake.Requests()) != 2 {
+		t.Errorf("Completions() = %q, requests = %d", reply.Content, len(fake.Requests()))
+	}
+
+	fake.Err = errors.New("unavailable")
+	if _, err := fake.StreamChat(context.Background(), nil, SessionSettings{}, make(chan string)); err == nil {
+		t.Error("StreamChat() want error")
+	}
+}
+
+func TestCompactContext(t *testing.T) {
+	fake := NewFakeProvider("第一批摘要", "新的摘要")
+	fake.Model = "fake-2k"
+	long := strings.Repeat("hello ", 600)
+	msgs := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: "system prompt"},
+		{Role: openai.ChatMessageRoleUser, Content: "q1 " + long},
+		{Role: openai.ChatMessageRoleAssistant, Content: "a1 " + long},
+		{Role: openai.ChatMessageRoleUser, Content: "q2"},
+	}
+
+	kept, summary, err := CompactContext(context.Background(), fake, msgs, "", SessionSettings{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary != "新的摘要" || len(kept) != 2 || kept[1].Content != "q2" {
+		t.Errorf("CompactContext() kept = %d, summary = %q", len(kept), summary)
+	}
+	// 两轮内容超过摘要请求的窗口，分两批摘要
+	requests := fake.Requests()
+	if len(requests) != 2 || !strings.Contains(requests[0][1].Content, "q1") || !strings.Contains(requests[1][1].Content, "a1") {
+		t.Errorf("CompactContext() summarize requests = %d", len(requests))
+	}
+
+	// 预算内不需要摘要
+	kept, summary, _ = CompactContext(context.Background(), fake, msgs[3:], "旧摘要", SessionSettings{})
+	if len(kept) != 1 || summary != "旧摘要" || len(fake.Requests()) != 2 {
+		t.Errorf("CompactContext() within budget kept = %d, summary = %q", len(kept), summary)
+	}
+}
+
+func TestSummarizeChunks(t *testing.T) {
+	fake := NewFakeProvider("摘要一", "摘要二", "摘要三")
+	fake.Model = "fake-2k"
+	long := strings.Repeat("hello ", 600)
+	evicted := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleUser, Content: "q1 " + long},
+		{Role: openai.ChatMessageRoleAssistant, Content: "a1 " + long},
+		{Role: openai.ChatMessageRoleUser, Content: "q2 " + strings.Repeat(long, 2)},
+	}
+	summary, err := Summarize(context.Background(), fake, "", evicted, fake.Model)
+	if err != nil || summary != "摘要三" {
+		t.Fatalf("Summarize() = %.100q, %v", summary, err)
+	}
+	requests := fake.Requests()
+	if len(requests) != 3 {
+		t.Fatalf("Summarize() requests = %d, want 3", len(requests))
+	}
+	// 每一批都合并上一批的摘要，超长的消息被截断
+	last := requests[2][1].Content
+	if !strings.Contains(last, "摘要二") || !strings.Contains(last, "q2") || !strings.HasSuffix(strings.TrimSpace(last), "…") {
+		t.Errorf("last summarize request = %.100s", last)
+	}
+	for i, request := range requests {
+		if tokens := CalculateTokenLength(request[1]); tokens > ContextWindow(fake.Model) {
+			t.Errorf("request %d tokens = %d, exceeds window", i, tokens)
+		}
+	}
+
+	fake.Err = errors.New("service unavailable")
+	kept, summary, err := CompactContext(context.Background(), fake, append([]openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: "system prompt"},
+	}, evicted...), "旧摘要", SessionSettings{})
+	if err == nil || summary != "旧摘要" || len(kept) != 2 {
+		t.Errorf("CompactContext() on error = %d, %q, %v", len(kept), summary, err)
+	}
+}
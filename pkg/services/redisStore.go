@@ -0,0 +1,229 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisSessionPrefix = "feishu-kimi:session:"
+	redisLockPrefix    = "feishu-kimi:lock:"
+	redisHistoryPrefix = "feishu-kimi:history:"
+	redisFlagPrefix    = "feishu-kimi:flag:"
+)
+
+var ErrSessionLocked = errors.New("session is locked by another replica")
+
+var (
+	// 持有锁期间每隔 redisLockTTL/3 续期一次，副本崩溃时锁最多保留 redisLockTTL
+	redisLockTTL   = time.Second * 30
+	redisLockWait  = time.Minute * 5
+	redisLockRetry = time.Millisecond * 100
+	redisOpTimeout = time.Second * 5
+)
+
+// 仅当锁仍属于自己时才释放
+var redisUnlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// 仅当锁仍属于自己时才续期
+var redisRenewScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+type redisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore 基于 Redis 协议的共享存储，多副本部署时共享会话
+func NewRedisStore(addr, password string, db int) (SessionStore, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: password,
+		DB:       db,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("connect redis %s: %w", addr, err)
+	}
+	return &redisStore{client: client}, nil
+}
+
+func (s *redisStore) Get(sessionId string) (*SessionMeta, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+	v, err := s.client.Get(ctx, redisSessionPrefix+sessionId).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("redis store get %s error: %v", sessionId, err)
+		return nil, false
+	}
+	var sessionMeta SessionMeta
+	if err := json.Unmarshal(v, &sessionMeta); err != nil {
+		log.Printf("redis store unmarshal %s error: %v", sessionId, err)
+		return nil, false
+	}
+	return &sessionMeta, true
+}
+
+func (s *redisStore) Set(sessionId string, sessionMeta *SessionMeta, expiration time.Duration) {
+	v, err := json.Marshal(sessionMeta)
+	if err != nil {
+		log.Printf("redis store marshal %s error: %v", sessionId, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+	if err := s.client.Set(ctx, redisSessionPrefix+sessionId, v, expiration).Err(); err != nil {
+		log.Printf("redis store set %s error: %v", sessionId, err)
+	}
+}
+
+func (s *redisStore) Delete(sessionId string) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+	if err := s.client.Del(ctx, redisSessionPrefix+sessionId).Err(); err != nil {
+		log.Printf("redis store delete %s error: %v", sessionId, err)
+	}
+}
+
+func (s *redisStore) GetHistory(userId string) []HistoryEntry {
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+	v, err := s.client.Get(ctx, redisHistoryPrefix+userId).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	if err != nil {
+		log.Printf("redis store get history %s error: %v", userId, err)
+		return nil
+	}
+	var history []HistoryEntry
+	if err := json.Unmarshal(v, &history); err != nil {
+		log.Printf("redis store unmarshal history %s error: %v", userId, err)
+		return nil
+	}
+	return history
+}
+
+func (s *redisStore) SetHistory(userId string, history []HistoryEntry, expiration time.Duration) {
+	v, err := json.Marshal(history)
+	if err != nil {
+		log.Printf("redis store marshal history %s error: %v", userId, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+	if err := s.client.Set(ctx, redisHistoryPrefix+userId, v, expiration).Err(); err != nil {
+		log.Printf("redis store set history %s error: %v", userId, err)
+	}
+}
+
+func (s *redisStore) SetFlag(key string, expiration time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+	if err := s.client.Set(ctx, redisFlagPrefix+key, 1, expiration).Err(); err != nil {
+		log.Printf("redis store set flag %s error: %v", key, err)
+	}
+}
+
+func (s *redisStore) HasFlag(key string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+	n, err := s.client.Exists(ctx, redisFlagPrefix+key).Result()
+	if err != nil {
+		log.Printf("redis store get flag %s error: %v", key, err)
+		return false
+	}
+	return n > 0
+}
+
+func (s *redisStore) DeleteFlag(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+	if err := s.client.Del(ctx, redisFlagPrefix+key).Err(); err != nil {
+		log.Printf("redis store delete flag %s error: %v", key, err)
+	}
+}
+
+// Lock 使用 SET NX 实现跨副本的会话锁，等待超时返回 ErrSessionLocked
+func (s *redisStore) Lock(sessionId string) (func(), error) {
+	key := redisLockPrefix + sessionId
+	token := uuid.New().String()
+	deadline := time.Now().Add(redisLockWait)
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+		ok, err := s.client.SetNX(ctx, key, token, redisLockTTL).Result()
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, ErrSessionLocked
+		}
+		time.Sleep(redisLockRetry)
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go s.renewLock(sessionId, key, token, stop, done)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stop)
+			<-done
+			ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+			defer cancel()
+			if err := redisUnlockScript.Run(ctx, s.client, []string{key}, token).Err(); err != nil {
+				log.Printf("redis store unlock %s error: %v", sessionId, err)
+			}
+		})
+	}, nil
+}
+
+// renewLock 定期延长锁的过期时间，直到解锁或锁已不属于自己
+func (s *redisStore) renewLock(sessionId, key, token string, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ttl := redisLockTTL
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+		renewed, err := redisRenewScript.Run(ctx, s.client, []string{key}, token, ttl.Milliseconds()).Int()
+		cancel()
+		if err != nil {
+			log.Printf("redis store renew lock %s error: %v", sessionId, err)
+			continue
+		}
+		if renewed == 0 {
+			log.Printf("redis store lock %s lost before unlock", sessionId)
+			return
+		}
+	}
+}
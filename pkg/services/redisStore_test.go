@@ -0,0 +1,139 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func newTestRedisStore(t *testing.T, mr *miniredis.Miniredis) SessionStore {
+	store, err := NewRedisStore(mr.Addr(), "", 0)
+	if err != nil {
+		t.Fatalf("NewRedisStore() error = %v", err)
+	}
+	return store
+}
+
+func TestRedisStoreGetSet(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store := newTestRedisStore(t, mr)
+
+	sessionMeta := &SessionMeta{
+		Mode: "chat",
+		Msg: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: "system"},
+			{Role: openai.ChatMessageRoleUser, Content: "hello", Name: "ou_1"},
+		},
+	}
+	store.Set("om_1", sessionMeta, time.Hour)
+
+	// 另一个副本读取到相同的会话
+	replica := newTestRedisStore(t, mr)
+	got, ok := replica.Get("om_1")
+	if !ok {
+		t.Fatalf("Get() ok = false, want true")
+	}
+	if got.Mode != sessionMeta.Mode || len(got.Msg) != 2 || got.Msg[1].Content != "hello" {
+		t.Errorf("Get() got = %+v, want %+v", got, sessionMeta)
+	}
+
+	mr.FastForward(time.Hour + time.Second)
+	if _, ok := replica.Get("om_1"); ok {
+		t.Errorf("Get() after expiration ok = true, want false")
+	}
+
+	store.Set("om_2", sessionMeta, time.Hour)
+	store.Delete("om_2")
+	if _, ok := replica.Get("om_2"); ok {
+		t.Errorf("Get() after Delete ok = true, want false")
+	}
+}
+
+func TestRedisStoreLock(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store := newTestRedisStore(t, mr)
+	replica := newTestRedisStore(t, mr)
+
+	wait := redisLockWait
+	redisLockWait = time.Millisecond * 300
+	defer func() { redisLockWait = wait }()
+
+	unlock, err := store.Lock("om_1")
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	if _, err := replica.Lock("om_1"); err != ErrSessionLocked {
+		t.Errorf("Lock() on locked session error = %v, want %v", err, ErrSessionLocked)
+	}
+	// 不同会话互不影响
+	unlockOther, err := replica.Lock("om_2")
+	if err != nil {
+		t.Fatalf("Lock() other session error = %v", err)
+	}
+	unlockOther()
+
+	done := make(chan error, 1)
+	go func() {
+		unlock, err := replica.Lock("om_1")
+		if err == nil {
+			unlock()
+		}
+		done <- err
+	}()
+	time.Sleep(time.Millisecond * 50)
+	unlock()
+	if err := <-done; err != nil {
+		t.Errorf("Lock() after unlock error = %v, want nil", err)
+	}
+}
+
+func TestRedisStoreLockRenew(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store := newTestRedisStore(t, mr)
+
+	ttl := redisLockTTL
+	redisLockTTL = time.Millisecond * 300
+	defer func() { redisLockTTL = ttl }()
+
+	unlock, err := store.Lock("om_1")
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	key := redisLockPrefix + "om_1"
+	// 模拟时间流逝到锁快要过期，续期后过期时间恢复为 redisLockTTL
+	mr.FastForward(time.Millisecond * 250)
+	time.Sleep(time.Millisecond * 150)
+	if got := mr.TTL(key); got <= time.Millisecond*100 {
+		t.Errorf("TTL() after renew = %v, want close to %v", got, redisLockTTL)
+	}
+	unlock()
+	unlock()
+	if mr.Exists(key) {
+		t.Error("lock still exists after unlock")
+	}
+	// 解锁后不再续期，也不会重新创建锁
+	time.Sleep(time.Millisecond * 150)
+	if mr.Exists(key) {
+		t.Error("lock recreated after unlock")
+	}
+}
+
+func TestRedisStoreFlag(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store := newTestRedisStore(t, mr)
+	store.SetFlag("import:oc_1:ou_1", time.Minute)
+	if !newTestRedisStore(t, mr).HasFlag("import:oc_1:ou_1") {
+		t.Fatal("HasFlag() on another replica = false after SetFlag")
+	}
+	mr.FastForward(time.Minute * 2)
+	if store.HasFlag("import:oc_1:ou_1") {
+		t.Error("HasFlag() = true after expiration")
+	}
+	store.SetFlag("import:oc_1:ou_1", time.Minute)
+	store.DeleteFlag("import:oc_1:ou_1")
+	if store.HasFlag("import:oc_1:ou_1") {
+		t.Error("HasFlag() = true after DeleteFlag")
+	}
+}
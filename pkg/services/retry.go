@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// RetryPolicy 请求失败时的重试策略，等待时间按指数增长并加入随机抖动
+type RetryPolicy struct {
+	MaxAttempts int           `mapstructure:"max_attempts"` // 包含第一次请求，1 表示不重试
+	BaseDelay   time.Duration `mapstructure:"base_delay"`
+	MaxDelay    time.Duration `mapstructure:"max_delay"` // Retry-After 超过该值时不再重试
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    10 * time.Second,
+}
+
+// withDefaults 未配置的字段使用 DefaultRetryPolicy
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = DefaultRetryPolicy.BaseDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = DefaultRetryPolicy.MaxDelay
+	}
+	return p
+}
+
+// Backoff 第 attempt 次失败后的等待时间，服务端要求的 Retry-After 更长时以其为准
+func (p RetryPolicy) Backoff(attempt int, retryAfter time.Duration) time.Duration {
+	delay := p.MaxDelay
+	if attempt < 32 {
+		delay = min(p.BaseDelay<<(attempt-1), p.MaxDelay)
+	}
+	// 在 [delay/2, delay) 之间抖动，避免多个请求同时重试
+	if half := delay / 2; half > 0 {
+		delay = half + time.Duration(rand.Int63n(int64(half)))
+	}
+	return max(delay, retryAfter)
+}
+
+// sleep 等待 d，ctx 结束时提前返回
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// isRetryableStatus 限流和服务端错误可以重试
+func isRetryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// retryTransport 在收到响应头之前失败或返回可重试的状态码时重新请求，
+// 流式响应开始后不会重试
+type retryTransport struct {
+	policy RetryPolicy
+	base   http.RoundTripper
+	logger *zap.Logger
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		attemptReq, err := replayRequest(req, attempt > 1)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := t.base.RoundTrip(attemptReq)
+		if attempt >= t.policy.MaxAttempts || req.Context().Err() != nil {
+			return resp, err
+		}
+		var delay time.Duration
+		if err != nil {
+			delay = t.policy.Backoff(attempt, 0)
+		} else {
+			if !isRetryableStatus(resp.StatusCode) {
+				return resp, nil
+			}
+			wait := retryAfter(resp)
+			if wait > t.policy.MaxDelay {
+				return resp, nil
+			}
+			delay = t.policy.Backoff(attempt, wait)
+		}
+		if t.logger != nil {
+			fields := []zap.Field{
+				zap.String("method", req.Method), zap.String("path", req.URL.Path),
+				zap.Int("attempt", attempt), zap.Duration("delay", delay),
+			}
+			if err != nil {
+				fields = append(fields, zap.Error(err))
+			} else {
+				fields = append(fields, zap.Int("status", resp.StatusCode))
+			}
+			t.logger.Warn("request retry", fields...)
+		}
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if err := sleep(req.Context(), delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// replayRequest 复制请求，重新请求时重新生成请求体
+func replayRequest(req *http.Request, replay bool) (*http.Request, error) {
+	attempt := req.Clone(req.Context())
+	if !replay || req.Body == nil || req.Body == http.NoBody {
+		return attempt, nil
+	}
+	if req.GetBody == nil {
+		return nil, fmt.Errorf("request body can not be replayed")
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	attempt.Body = body
+	return attempt, nil
+}
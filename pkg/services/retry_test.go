@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"go.uber.org/zap"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	tests := []struct {
+		attempt    int
+		retryAfter time.Duration
+		min, max   time.Duration
+	}{
+		{attempt: 1, min: 50 * time.Millisecond, max: 100 * time.Millisecond},
+		{attempt: 3, min: 200 * time.Millisecond, max: 400 * time.Millisecond},
+		{attempt: 10, min: 500 * time.Millisecond, max: time.Second},
+		{attempt: 100, min: 500 * time.Millisecond, max: time.Second},
+		{attempt: 1, retryAfter: 2 * time.Second, min: 2 * time.Second, max: 2 * time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			got := policy.Backoff(tt.attempt, tt.retryAfter)
+			if got < tt.min || got > tt.max {
+				t.Fatalf("Backoff(%d, %v) = %v, want in [%v, %v]", tt.attempt, tt.retryAfter, got, tt.min, tt.max)
+			}
+		}
+	}
+}
+
+// failingServer 前 failures 次请求调用 fail，之后调用 ok
+func failingServer(t *testing.T, failures int32, fail, ok http.HandlerFunc) (*ChatGPT, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			fail(w, r)
+			return
+		}
+		ok(w, r)
+	}))
+	t.Cleanup(server.Close)
+	gpt, err := NewChatGPT(ModelProfile{
+		Name:    DefaultProfile,
+		ApiUrl:  server.URL,
+		ApiKeys: []string{"sk-test"},
+		Model:   "test-model",
+		Retry:   RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Second},
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gpt, &calls
+}
+
+func unavailable(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusServiceUnavailable)
+	w.Write([]byte(`{"error":{"message":"overloaded"}}`))
+}
+
+func completionOK(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`))
+}
+
+func streamOK(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"你好\"},\"finish_reason\":\"stop\"}]}\n\n"))
+	w.Write([]byte("data: [DONE]\n\n"))
+}
+
+// streamAborted 返回部分内容后断开连接，content 为空时不返回任何内容
+func streamAborted(content string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		if content != "" {
+			w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"" + content + "\"}}]}\n\n"))
+		}
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+}
+
+func TestRetryCompletions(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int32
+		fail      http.HandlerFunc
+		wantErr   bool
+		wantCalls int32
+	}{
+		{name: "503 后重试成功", failures: 2, fail: unavailable, wantCalls: 3},
+		{name: "超过重试次数", failures: 3, fail: unavailable, wantErr: true, wantCalls: 3},
+		{name: "429 遵循 Retry-After", failures: 1, fail: func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}, wantCalls: 2},
+		{name: "Retry-After 过长时不重试", failures: 1, fail: func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}, wantErr: true, wantCalls: 1},
+		{name: "400 不重试", failures: 1, fail: func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+		}, wantErr: true, wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gpt, calls := failingServer(t, tt.failures, tt.fail, completionOK)
+			_, err := gpt.Completions(context.Background(), []openai.ChatCompletionMessage{
+				{Role: openai.ChatMessageRoleUser, Content: "hi"},
+			}, SessionSettings{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Completions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("calls = %v, want %v", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetryStreamChat(t *testing.T) {
+	tests := []struct {
+		name       string
+		fail       http.HandlerFunc
+		wantAnswer string
+		wantErr    bool
+		wantCalls  int32
+	}{
+		{name: "建立连接失败后重试", fail: unavailable, wantAnswer: "你好", wantCalls: 2},
+		{name: "返回内容前断开后重试", fail: streamAborted(""), wantAnswer: "你好", wantCalls: 2},
+		{name: "返回内容后断开不重试", fail: streamAborted("部分"), wantAnswer: "部分", wantErr: true, wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gpt, calls := failingServer(t, 1, tt.fail, streamOK)
+			answer, err := streamAll(t, gpt, SessionSettings{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("StreamChat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if answer != tt.wantAnswer {
+				t.Errorf("StreamChat() answer = %v, want %v", answer, tt.wantAnswer)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("calls = %v, want %v", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetryFiles(t *testing.T) {
+	gpt, calls := failingServer(t, 1, unavailable, func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("ParseMultipartForm() error = %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"file-1","filename":"a.txt"}`))
+	})
+	path := filepath.Join(t.TempDir(), "a.txt")
+	if err := os.WriteFile(path, []byte("hello"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	file, err := gpt.CreateFile(context.Background(), path)
+	if err != nil {
+		t.Fatalf("CreateFile() error = %v", err)
+	}
+	if file.ID != "file-1" || calls.Load() != 2 {
+		t.Errorf("CreateFile() = %v, calls = %v, want file-1 after 2 calls", file.ID, calls.Load())
+	}
+
+	gpt, calls = failingServer(t, 2, unavailable, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("content"))
+	})
+	content, err := gpt.GetFileContent(context.Background(), "file-1")
+	if err != nil {
+		t.Fatalf("GetFileContent() error = %v", err)
+	}
+	content.Close()
+	if calls.Load() != 3 {
+		t.Errorf("GetFileContent() calls = %v, want 3", calls.Load())
+	}
+}
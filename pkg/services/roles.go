@@ -0,0 +1,126 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Role 角色扮演的预设
+type Role struct {
+	Title       string   `yaml:"title"`
+	Tags        []string `yaml:"tags"`
+	Prompt      string   `yaml:"prompt"`
+	Model       string   `yaml:"model,omitempty"`
+	Temperature *float32 `yaml:"temperature,omitempty"`
+}
+
+// Settings 返回使用该角色开启新话题时的设置，与 /set 使用相同的校验
+func (r Role) Settings() (SessionSettings, error) {
+	settings := SessionSettings{SystemPrompt: r.Prompt}
+	if r.Model != "" {
+		if err := settings.Set(SettingModel, r.Model); err != nil {
+			return settings, err
+		}
+	}
+	if r.Temperature != nil {
+		value := strconv.FormatFloat(float64(*r.Temperature), 'f', -1, 32)
+		if err := settings.Set(SettingTemperature, value); err != nil {
+			return settings, err
+		}
+	}
+	return settings, nil
+}
+
+type RoleCatalog struct {
+	roles []Role
+}
+
+// LoadRoleCatalog 从 YAML 文件加载角色列表，文件不存在时返回空列表
+func LoadRoleCatalog(path string) (*RoleCatalog, error) {
+	catalog := &RoleCatalog{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return catalog, nil
+	}
+	if err != nil {
+		return catalog, err
+	}
+	var roles []Role
+	if err := yaml.Unmarshal(data, &roles); err != nil {
+		return catalog, fmt.Errorf("parse %s: %w", path, err)
+	}
+	seen := map[string]bool{}
+	for i, role := range roles {
+		if role.Title == "" || role.Prompt == "" {
+			return catalog, fmt.Errorf("role #%d: title and prompt are required", i+1)
+		}
+		if seen[role.Title] {
+			return catalog, fmt.Errorf("role %q: duplicate title", role.Title)
+		}
+		if _, err := role.Settings(); err != nil {
+			return catalog, fmt.Errorf("role %q: %w", role.Title, err)
+		}
+		seen[role.Title] = true
+	}
+	catalog.roles = roles
+	return catalog, nil
+}
+
+// Check 校验角色的设置是否适用于模型，例如 max_tokens 不能超过角色所选模型的上下文窗口
+func (c *RoleCatalog) Check(llm LLMProvider) error {
+	for _, role := range c.roles {
+		settings, err := role.Settings()
+		if err == nil {
+			err = CheckSettings(llm, settings)
+		}
+		if err != nil {
+			return fmt.Errorf("role %q: %w", role.Title, err)
+		}
+	}
+	return nil
+}
+
+func (c *RoleCatalog) Len() int {
+	return len(c.roles)
+}
+
+// Tags 返回所有角色分类，按首次出现的顺序
+func (c *RoleCatalog) Tags() []string {
+	var tags []string
+	seen := map[string]bool{}
+	for _, role := range c.roles {
+		for _, tag := range role.Tags {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+func (c *RoleCatalog) TitlesByTag(tag string) []string {
+	var titles []string
+	for _, role := range c.roles {
+		for _, t := range role.Tags {
+			if t == tag {
+				titles = append(titles, role.Title)
+				break
+			}
+		}
+	}
+	return titles
+}
+
+func (c *RoleCatalog) RoleByTitle(title string) (Role, bool) {
+	for _, role := range c.roles {
+		if role.Title == title {
+			return role, true
+		}
+	}
+	return Role{}, false
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadRoleCatalog(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	catalog, err := LoadRoleCatalog(filepath.Join(dir, "missing.yaml"))
+	if err != nil || catalog.Len() != 0 {
+		t.Fatalf("missing file got %v, %v, want empty catalog", catalog.Len(), err)
+	}
+
+	catalog, err = LoadRoleCatalog(write("roles.yaml", `
+- title: 翻译
+  tags: [办公, 语言]
+  prompt: 翻译
+  temperature: 0.1
+- title: 周报
+  tags: [办公]
+  prompt: 周报
+  model: moonshot-v1-32k
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := catalog.Tags(); !reflect.DeepEqual(got, []string{"办公", "语言"}) {
+		t.Errorf("Tags() = %v", got)
+	}
+	if got := catalog.TitlesByTag("办公"); !reflect.DeepEqual(got, []string{"翻译", "周报"}) {
+		t.Errorf("TitlesByTag() = %v", got)
+	}
+	role, ok := catalog.RoleByTitle("周报")
+	settings, err := role.Settings()
+	if !ok || err != nil || settings.Model != "moonshot-v1-32k" || settings.SystemPrompt != "周报" {
+		t.Errorf("RoleByTitle() = %+v, %v, settings %+v, %v", role, ok, settings, err)
+	}
+	if err := catalog.Check(NewFakeProvider()); err != nil {
+		t.Errorf("Check() = %v", err)
+	}
+
+	// 与 /set 的范围一致，temperature 可以超过 1
+	catalog, err = LoadRoleCatalog(write("hot.yaml", "- {title: a, prompt: a, temperature: 1.5}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	role, _ = catalog.RoleByTitle("a")
+	if settings, _ := role.Settings(); settings.Temperature == nil || *settings.Temperature != 1.5 {
+		t.Errorf("Settings().Temperature = %v", settings.Temperature)
+	}
+	// 模型的上下文窗口放不下全局的 max_tokens
+	catalog, err = LoadRoleCatalog(write("small.yaml", "- {title: a, prompt: a, model: moonshot-v1-8k}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := catalog.Check(&FakeProvider{Model: "moonshot-v1-128k", MaxTokens: 10000}); err == nil {
+		t.Error("Check() with a small context window: want error")
+	}
+
+	invalid := map[string]string{
+		"missing prompt": "- title: a\n",
+		"duplicate":      "- {title: a, prompt: a}\n- {title: a, prompt: b}\n",
+		"temperature":    "- {title: a, prompt: a, temperature: 2.5}\n",
+		"model":          "- {title: a, prompt: a, model: 'moonshot v1'}\n",
+	}
+	for name, content := range invalid {
+		if _, err := LoadRoleCatalog(write(name+".yaml", content)); err == nil {
+			t.Errorf("%s: want error", name)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"go.uber.org/zap"
+)
+
+// DefaultProfile 由 OPENAI_* 配置生成的模型配置名
+const DefaultProfile = "default"
+
+// ModelProfile 一组命名的模型配置
+type ModelProfile struct {
+	Name      string   `mapstructure:"name"`
+	ApiUrl    string   `mapstructure:"api_url"`
+	ApiKeys   []string `mapstructure:"api_key"` // 多个 key 组成 key 池
+	Model     string   `mapstructure:"model"`
+	MaxTokens int      `mapstructure:"max_tokens"`
+
+	KeyStrategy string        `mapstructure:"key_strategy"`
+	KeyCooldown time.Duration `mapstructure:"key_cooldown"`
+
+	Retry RetryPolicy `mapstructure:"retry"`
+}
+
+// RouteRule 路由规则，非空的条件都满足时命中，按配置顺序匹配
+type RouteRule struct {
+	ChatId   string   `mapstructure:"chat_id"`
+	UserId   string   `mapstructure:"user_id"`
+	ChatType string   `mapstructure:"chat_type"`
+	Profile  string   `mapstructure:"profile"`
+	Fallback []string `mapstructure:"fallback"`
+}
+
+// Route 请求所属的会话和用户
+type Route struct {
+	ChatId   string
+	UserId   string
+	ChatType string
+}
+
+func (r RouteRule) match(route Route) bool {
+	return (r.ChatId == "" || r.ChatId == route.ChatId) &&
+		(r.UserId == "" || r.UserId == route.UserId) &&
+		(r.ChatType == "" || r.ChatType == route.ChatType)
+}
+
+// Router 按会话选择模型配置，并在主配置失败时依次尝试备用配置
+type Router struct {
+	providers map[string]LLMProvider
+	rules     []RouteRule
+	fallback  []string
+	logger    *zap.Logger
+}
+
+// NewRouter providers 中必须包含 DefaultProfile，fallback 为未单独配置时的备用列表
+func NewRouter(providers map[string]LLMProvider, rules []RouteRule, fallback []string, logger *zap.Logger) (*Router, error) {
+	if _, ok := providers[DefaultProfile]; !ok {
+		return nil, fmt.Errorf("model profile %q is required", DefaultProfile)
+	}
+	check := func(names ...string) error {
+		for _, name := range names {
+			if _, ok := providers[name]; !ok {
+				return fmt.Errorf("unknown model profile: %v", name)
+			}
+		}
+		return nil
+	}
+	if err := check(fallback...); err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		if err := check(rule.Profile); err != nil {
+			return nil, err
+		}
+		if err := check(rule.Fallback...); err != nil {
+			return nil, err
+		}
+	}
+	return &Router{providers: providers, rules: rules, fallback: fallback, logger: logger}, nil
+}
+
+// KeyStats 返回各模型配置的 key 池状态
+func (r *Router) KeyStats() map[string][]KeyStat {
+	stats := map[string][]KeyStat{}
+	for name, provider := range r.providers {
+		if pool, ok := provider.(interface{ KeyStats() []KeyStat }); ok {
+			stats[name] = pool.KeyStats()
+		}
+	}
+	return stats
+}
+
+// Default 未命中任何规则时使用的模型，上传的文件也保存在该配置中
+func (r *Router) Default() LLMProvider {
+	return r.chain(DefaultProfile, r.fallback)
+}
+
+// Route 返回会话使用的模型
+func (r *Router) Route(route Route) LLMProvider {
+	for _, rule := range r.rules {
+		if rule.match(route) {
+			fallback := rule.Fallback
+			if fallback == nil {
+				fallback = r.fallback
+			}
+			return r.chain(rule.Profile, fallback)
+		}
+	}
+	return r.Default()
+}
+
+func (r *Router) chain(primary string, fallback []string) *FallbackProvider {
+	names := []string{primary}
+	for _, name := range fallback {
+		if name != primary {
+			names = append(names, name)
+		}
+	}
+	chain := &FallbackProvider{logger: r.logger}
+	for _, name := range names {
+		chain.names = append(chain.names, name)
+		chain.providers = append(chain.providers, r.providers[name])
+	}
+	return chain
+}
+
+// FallbackProvider 依次尝试多个模型配置，会话设置中的模型只对主配置生效
+type FallbackProvider struct {
+	names     []string
+	providers []LLMProvider
+	logger    *zap.Logger
+}
+
+var _ LLMProvider = (*FallbackProvider)(nil)
+
+func (f *FallbackProvider) primary() LLMProvider {
+	return f.providers[0]
+}
+
+// Profile 返回主配置的名称
+func (f *FallbackProvider) Profile() string {
+	return f.names[0]
+}
+
+func (f *FallbackProvider) settingsFor(i int, settings SessionSettings) SessionSettings {
+	if i > 0 {
+		settings.Model = ""
+	}
+	return settings
+}
+
+func (f *FallbackProvider) ModelOf(settings SessionSettings) string {
+	return f.primary().ModelOf(settings)
+}
+
+func (f *FallbackProvider) MaxTokensOf(settings SessionSettings) int {
+	return f.primary().MaxTokensOf(settings)
+}
+
+func (f *FallbackProvider) Completions(ctx context.Context, msgs []openai.ChatCompletionMessage, settings SessionSettings) (openai.ChatCompletionMessage, error) {
+	var errs []error
+	for i, provider := range f.providers {
+		msg, err := provider.Completions(ctx, msgs, f.settingsFor(i, settings))
+		if err == nil {
+			return msg, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", f.names[i], err))
+		f.logFallback(i, err)
+	}
+	return openai.ChatCompletionMessage{}, errors.Join(errs...)
+}
+
+func (f *FallbackProvider) StreamChat(ctx context.Context, msgs []openai.ChatCompletionMessage, settings SessionSettings, responseStream chan<- string) (openai.FinishReason, error) {
+	finishReason, _, err := f.StreamChatTools(ctx, msgs, settings, nil, "", responseStream)
+	return finishReason, err
+}
+
+// StreamChatTools 只有在还没有收到任何回答时才切换到备用配置，避免回答重复
+func (f *FallbackProvider) StreamChatTools(ctx context.Context, msgs []openai.ChatCompletionMessage, settings SessionSettings, tools []openai.Tool, toolChoice string, responseStream chan<- string) (openai.FinishReason, []openai.ToolCall, error) {
+	defer close(responseStream)
+	var errs []error
+	for i, provider := range f.providers {
+		stream := make(chan string)
+		done := make(chan struct{})
+		var finishReason openai.FinishReason
+		var toolCalls []openai.ToolCall
+		var err error
+		go func() {
+			defer close(done)
+			finishReason, toolCalls, err = provider.StreamChatTools(ctx, msgs, f.settingsFor(i, settings), tools, toolChoice, stream)
+		}()
+		received := false
+		for chunk := range stream {
+			received = received || chunk != ""
+			responseStream <- chunk
+		}
+		<-done
+		if err == nil || received || ctx.Err() != nil {
+			return finishReason, toolCalls, err
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", f.names[i], err))
+		f.logFallback(i, err)
+	}
+	return "", nil, errors.Join(errs...)
+}
+
+func (f *FallbackProvider) logFallback(i int, err error) {
+	if f.logger == nil || i+1 >= len(f.names) {
+		return
+	}
+	f.logger.Warn("model profile failed, falling back",
+		zap.String("profile", f.names[i]), zap.String("next", f.names[i+1]), zap.Error(err))
+}
+
+func (f *FallbackProvider) CreateFile(ctx context.Context, filePath string) (*openai.File, error) {
+	return f.primary().CreateFile(ctx, filePath)
+}
+
+func (f *FallbackProvider) ListFiles(ctx context.Context) (*openai.FilesList, error) {
+	return f.primary().ListFiles(ctx)
+}
+
+func (f *FallbackProvider) DeleteFile(ctx context.Context, fileID string) error {
+	return f.primary().DeleteFile(ctx, fileID)
+}
+
+func (f *FallbackProvider) GetFile(ctx context.Context, fileID string) (*openai.File, error) {
+	return f.primary().GetFile(ctx, fileID)
+}
+
+func (f *FallbackProvider) GetFileContent(ctx context.Context, fileID string) (io.ReadCloser, error) {
+	return f.primary().GetFileContent(ctx, fileID)
+}
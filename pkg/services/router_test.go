@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func streamAll(t *testing.T, llm LLMProvider, settings SessionSettings) (string, error) {
+	t.Helper()
+	stream := make(chan string)
+	done := make(chan error, 1)
+	go func() {
+		_, err := llm.StreamChat(context.Background(), []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleUser, Content: "hi"},
+		}, settings, stream)
+		done <- err
+	}()
+	var answer strings.Builder
+	for chunk := range stream {
+		answer.WriteString(chunk)
+	}
+	return answer.String(), <-done
+}
+
+// partialProvider 先返回部分回答再报错
+type partialProvider struct {
+	*FakeProvider
+}
+
+func (p partialProvider) StreamChatTools(ctx context.Context, msgs []openai.ChatCompletionMessage, settings SessionSettings, tools []openai.Tool, toolChoice string, responseStream chan<- string) (openai.FinishReason, []openai.ToolCall, error) {
+	defer close(responseStream)
+	responseStream <- "部分"
+	return "", nil, errors.New("connection reset")
+}
+
+func (p partialProvider) StreamChat(ctx context.Context, msgs []openai.ChatCompletionMessage, settings SessionSettings, responseStream chan<- string) (openai.FinishReason, error) {
+	finishReason, _, err := p.StreamChatTools(ctx, msgs, settings, nil, "", responseStream)
+	return finishReason, err
+}
+
+func TestRouter(t *testing.T) {
+	primary := NewFakeProvider()
+	primary.Err = errors.New("service unavailable")
+	backup := NewFakeProvider("backup answer")
+	backup.Model = "backup-model"
+	group := NewFakeProvider("group answer")
+	router, err := NewRouter(map[string]LLMProvider{
+		DefaultProfile: primary,
+		"backup":       backup,
+		"group":        group,
+		"partial":      partialProvider{NewFakeProvider()},
+	}, []RouteRule{
+		{ChatType: ChatTypeGroup, Profile: "group", Fallback: []string{}},
+		{UserId: "ou_partial", Profile: "partial"},
+	}, []string{"backup"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 主配置在第一个 token 之前失败，切换到备用配置
+	answer, err := streamAll(t, router.Route(Route{ChatType: ChatTypeP2P}), SessionSettings{Model: "moonshot-v1-8k"})
+	if err != nil || answer != "backup answer" {
+		t.Errorf("fallback answer = %q, %v", answer, err)
+	}
+	if len(primary.Requests()) != 1 || len(backup.Requests()) != 1 {
+		t.Errorf("requests primary = %d, backup = %d", len(primary.Requests()), len(backup.Requests()))
+	}
+
+	answer, err = streamAll(t, router.Route(Route{ChatType: ChatTypeGroup}), SessionSettings{})
+	if err != nil || answer != "group answer" {
+		t.Errorf("group answer = %q, %v", answer, err)
+	}
+
+	// 已经返回部分回答时不再切换
+	answer, err = streamAll(t, router.Route(Route{UserId: "ou_partial"}), SessionSettings{})
+	if err == nil || answer != "部分" || len(backup.Requests()) != 1 {
+		t.Errorf("partial answer = %q, %v, backup requests = %d", answer, err, len(backup.Requests()))
+	}
+
+	if _, err := NewRouter(map[string]LLMProvider{DefaultProfile: primary}, nil, []string{"missing"}, nil); err == nil {
+		t.Error("NewRouter() want error for unknown fallback")
+	}
+}
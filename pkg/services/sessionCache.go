@@ -6,14 +6,34 @@ import (
 
 	"github.com/pandodao/tokenizer-go"
 	openai "github.com/sashabaranov/go-openai"
-
-	"github.com/patrickmn/go-cache"
 )
 
 type SessionMode string
+
 type VisionDetail string
 type SessionService struct {
-	cache *cache.Cache
+	store    SessionStore
+	policies map[string]SessionPolicy
+}
+
+const (
+	ChatTypeP2P   = "p2p"
+	ChatTypeGroup = "group"
+)
+
+// 默认会话有效期
+const defaultSessionLifetime = time.Hour * 12
+
+const (
+	// 会话创建时写入的标记，会话过期后仍保留一段时间，用于区分话题已过期和从未有过会话
+	seenKeyPrefix  = "seen:"
+	seenExpiration = time.Hour * 24 * 30
+)
+
+// SessionPolicy 会话的有效期策略，按会话类型配置
+type SessionPolicy struct {
+	Lifetime time.Duration // 从话题开始计算的最长存活时间
+	Idle     time.Duration // 无新消息后的过期时间
 }
 type PicSetting struct {
 	resolution Resolution
@@ -27,63 +47,223 @@ type SessionMeta struct {
 	Msg          []openai.ChatCompletionMessage `json:"msg,omitempty"`
 	PicSetting   PicSetting                     `json:"pic_setting,omitempty"`
 	VisionDetail VisionDetail                   `json:"vision_detail,omitempty"`
+	// Summary 被裁剪掉的历史对话的滚动摘要
+	Summary   string          `json:"summary,omitempty"`
+	Settings  SessionSettings `json:"settings,omitempty"`
+	ChatType  string          `json:"chat_type,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
 }
 
 type SessionServiceCacheInterface interface {
+	GetMode(sessionId string) SessionMode
+	SetMode(sessionId string, mode SessionMode)
 	GetMsg(sessionId string) []openai.ChatCompletionMessage
 	SetMsg(sessionId string, msg []openai.ChatCompletionMessage)
+	GetSettings(sessionId string) SessionSettings
+	SetSettings(sessionId string, settings SessionSettings)
+	GetSummary(sessionId string) string
+	SetSummary(sessionId string, summary string)
+	GetChatType(sessionId string) string
+	SetChatType(sessionId string, chatType string)
+	Exists(sessionId string) bool
+	Expired(sessionId string) bool
+	Fork(sessionId string, newSessionId string) bool
+	RecordHistory(userId string, entry HistoryEntry)
+	GetHistory(userId string, chatId string) []HistoryEntry
 	Clear(sessionId string)
+	SetFlag(key string, expiration time.Duration)
+	HasFlag(key string) bool
+	ClearFlag(key string)
+	Lock(sessionId string) (func(), error)
 }
 
 var sessionServices *SessionService
 
+func (s *SessionService) GetMode(sessionId string) SessionMode {
+	sessionMeta, ok := s.store.Get(sessionId)
+	if !ok {
+		return ""
+	}
+	return sessionMeta.Mode
+}
+
+func (s *SessionService) SetMode(sessionId string, mode SessionMode) {
+	s.update(sessionId, func(sessionMeta *SessionMeta) {
+		sessionMeta.Mode = mode
+	})
+}
+
 func (s *SessionService) GetMsg(sessionId string) (msg []openai.ChatCompletionMessage) {
-	sessionContext, ok := s.cache.Get(sessionId)
+	sessionMeta, ok := s.store.Get(sessionId)
 	if !ok {
 		return nil
 	}
-	sessionMeta := sessionContext.(*SessionMeta)
 	return sessionMeta.Msg
 }
 
 func (s *SessionService) SetMsg(sessionId string, msg []openai.ChatCompletionMessage) {
-	maxLength := 4096
-	maxCacheTime := time.Hour * 12
+	s.update(sessionId, func(sessionMeta *SessionMeta) {
+		sessionMeta.Msg = msg
+	})
+}
 
-	//限制对话上下文长度
-	for getStrPoolTotalLength(msg) > maxLength {
-		msg = append(msg[:1], msg[2:]...)
+func (s *SessionService) GetSettings(sessionId string) SessionSettings {
+	sessionMeta, ok := s.store.Get(sessionId)
+	if !ok {
+		return SessionSettings{}
 	}
+	return sessionMeta.Settings
+}
 
-	sessionContext, ok := s.cache.Get(sessionId)
+func (s *SessionService) SetSettings(sessionId string, settings SessionSettings) {
+	s.update(sessionId, func(sessionMeta *SessionMeta) {
+		sessionMeta.Settings = settings
+	})
+}
+
+func (s *SessionService) GetSummary(sessionId string) string {
+	sessionMeta, ok := s.store.Get(sessionId)
 	if !ok {
-		sessionMeta := &SessionMeta{Msg: msg}
-		s.cache.Set(sessionId, sessionMeta, maxCacheTime)
-		return
+		return ""
 	}
-	sessionMeta := sessionContext.(*SessionMeta)
-	sessionMeta.Msg = msg
-	s.cache.Set(sessionId, sessionMeta, maxCacheTime)
+	return sessionMeta.Summary
+}
+
+func (s *SessionService) SetSummary(sessionId string, summary string) {
+	s.update(sessionId, func(sessionMeta *SessionMeta) {
+		sessionMeta.Summary = summary
+	})
+}
+
+func (s *SessionService) GetChatType(sessionId string) string {
+	sessionMeta, ok := s.store.Get(sessionId)
+	if !ok {
+		return ""
+	}
+	return sessionMeta.ChatType
+}
+
+func (s *SessionService) SetChatType(sessionId string, chatType string) {
+	s.update(sessionId, func(sessionMeta *SessionMeta) {
+		sessionMeta.ChatType = chatType
+	})
+}
+
+func (s *SessionService) Exists(sessionId string) bool {
+	_, ok := s.store.Get(sessionId)
+	return ok
+}
+
+// Expired 会话曾经存在但已过期，主动清除的会话不算过期
+func (s *SessionService) Expired(sessionId string) bool {
+	if s.Exists(sessionId) {
+		return false
+	}
+	_, seen := s.store.Get(seenKeyPrefix + sessionId)
+	return seen
+}
+
+// markSeen 记录会话已创建，标记比会话本身多保留 seenExpiration
+func (s *SessionService) markSeen(sessionId string, sessionMeta *SessionMeta) {
+	policy := s.policy(sessionMeta.ChatType)
+	s.store.Set(seenKeyPrefix+sessionId, &SessionMeta{CreatedAt: sessionMeta.CreatedAt}, policy.Lifetime+seenExpiration)
+}
+
+// Fork 复制会话的上下文、摘要和设置到新的会话，两者之后互不影响
+func (s *SessionService) Fork(sessionId string, newSessionId string) bool {
+	sessionMeta, ok := s.store.Get(sessionId)
+	if !ok || len(sessionMeta.Msg) == 0 {
+		return false
+	}
+	now := time.Now()
+	forked := &SessionMeta{
+		Msg:       append([]openai.ChatCompletionMessage(nil), sessionMeta.Msg...),
+		Summary:   sessionMeta.Summary,
+		Settings:  sessionMeta.Settings,
+		ChatType:  sessionMeta.ChatType,
+		CreatedAt: now,
+	}
+	s.store.Set(newSessionId, forked, s.expiration(forked, now))
+	s.markSeen(newSessionId, forked)
+	return true
+}
+
+// update 修改会话并续期，会话不存在时新建
+func (s *SessionService) update(sessionId string, fn func(sessionMeta *SessionMeta)) {
+	now := time.Now()
+	sessionMeta, ok := s.store.Get(sessionId)
+	if !ok {
+		sessionMeta = &SessionMeta{CreatedAt: now}
+	}
+	fn(sessionMeta)
+	s.store.Set(sessionId, sessionMeta, s.expiration(sessionMeta, now))
+	if !ok {
+		s.markSeen(sessionId, sessionMeta)
+	}
+}
+
+// expiration 计算会话剩余的有效期，取闲置过期和最长存活时间中较早的一个
+func (s *SessionService) expiration(sessionMeta *SessionMeta, now time.Time) time.Duration {
+	policy := s.policy(sessionMeta.ChatType)
+	if sessionMeta.CreatedAt.IsZero() {
+		sessionMeta.CreatedAt = now
+	}
+	expiration := policy.Lifetime - now.Sub(sessionMeta.CreatedAt)
+	if policy.Idle > 0 && policy.Idle < expiration {
+		expiration = policy.Idle
+	}
+	// 已超过最长存活时间，尽快过期
+	if expiration <= 0 {
+		expiration = time.Second
+	}
+	return expiration
+}
+
+func (s *SessionService) policy(chatType string) SessionPolicy {
+	policy, ok := s.policies[chatType]
+	if !ok {
+		policy = s.policies[ChatTypeP2P]
+	}
+	if policy.Lifetime <= 0 {
+		policy.Lifetime = defaultSessionLifetime
+	}
+	return policy
 }
 
 func (s *SessionService) Clear(sessionId string) {
 	// Delete the session context from the cache.
-	s.cache.Delete(sessionId)
+	s.store.Delete(sessionId)
+	s.store.Delete(seenKeyPrefix + sessionId)
 }
 
-func GetSessionCache() SessionServiceCacheInterface {
-	if sessionServices == nil {
-		sessionServices = &SessionService{cache: cache.New(time.Hour*12, time.Hour*1)}
-	}
+// SetFlag 设置一个临时标记，例如等待用户发送文件，不会创建会话
+func (s *SessionService) SetFlag(key string, expiration time.Duration) {
+	s.store.SetFlag(key, expiration)
+}
+
+func (s *SessionService) HasFlag(key string) bool {
+	return s.store.HasFlag(key)
+}
+
+func (s *SessionService) ClearFlag(key string) {
+	s.store.DeleteFlag(key)
+}
+
+// InitSessionCache 使用指定的存储后端和有效期策略初始化会话缓存
+func InitSessionCache(store SessionStore, policies map[string]SessionPolicy) SessionServiceCacheInterface {
+	sessionServices = &SessionService{store: store, policies: policies}
 	return sessionServices
 }
 
-func getStrPoolTotalLength(strPool []openai.ChatCompletionMessage) int {
-	var total int
-	for _, v := range strPool {
-		total += CalculateTokenLength(v)
+func (s *SessionService) Lock(sessionId string) (func(), error) {
+	return s.store.Lock(sessionId)
+}
+
+func GetSessionCache() SessionServiceCacheInterface {
+	if sessionServices == nil {
+		sessionServices = &SessionService{store: NewMemoryStore()}
 	}
-	return total
+	return sessionServices
 }
 
 func CalculateTokenLength(msg openai.ChatCompletionMessage) int {
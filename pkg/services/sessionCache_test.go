@@ -0,0 +1,136 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestSessionExpired(t *testing.T) {
+	s := &SessionService{store: NewMemoryStore(), policies: map[string]SessionPolicy{
+		ChatTypeP2P: {Lifetime: time.Hour, Idle: 50 * time.Millisecond},
+	}}
+	s.SetMsg("om_1", []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}})
+	s.SetMsg("om_2", []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}})
+	if s.Expired("om_1") {
+		t.Error("Expired() = true for an active session")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if !s.Expired("om_1") {
+		t.Error("Expired() = false after the session idled out")
+	}
+	// 从未创建过会话的话题，例如帮助卡片下的回复
+	if s.Expired("om_help") {
+		t.Error("Expired() = true for a session that never existed")
+	}
+	// 主动清除的会话不算过期
+	s.Clear("om_2")
+	if s.Expired("om_2") {
+		t.Error("Expired() = true for a cleared session")
+	}
+}
+
+func TestSessionExpirationPolicy(t *testing.T) {
+	s := &SessionService{store: NewMemoryStore(), policies: map[string]SessionPolicy{
+		ChatTypeP2P:   {Lifetime: time.Hour * 12, Idle: time.Hour * 2},
+		ChatTypeGroup: {Lifetime: time.Hour * 2},
+	}}
+	now := time.Now()
+	tests := []struct {
+		name      string
+		chatType  string
+		createdAt time.Time
+		want      time.Duration
+	}{
+		{name: "新会话按闲置时间过期", chatType: ChatTypeP2P, createdAt: now, want: time.Hour * 2},
+		{name: "接近最长存活时间", chatType: ChatTypeP2P, createdAt: now.Add(-time.Hour * 11), want: time.Hour},
+		{name: "超过最长存活时间", chatType: ChatTypeP2P, createdAt: now.Add(-time.Hour * 13), want: time.Second},
+		{name: "群聊没有闲置过期", chatType: ChatTypeGroup, createdAt: now.Add(-time.Hour), want: time.Hour},
+		{name: "未知类型使用单聊策略", chatType: "topic", createdAt: now, want: time.Hour * 2},
+		{name: "缺少创建时间时从现在开始计算", chatType: ChatTypeGroup, want: time.Hour * 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionMeta := &SessionMeta{ChatType: tt.chatType, CreatedAt: tt.createdAt}
+			if got := s.expiration(sessionMeta, now); got != tt.want {
+				t.Errorf("expiration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	// 未配置策略时使用默认的最长存活时间
+	if got := (&SessionService{}).expiration(&SessionMeta{}, now); got != defaultSessionLifetime {
+		t.Errorf("expiration() without policies = %v, want %v", got, defaultSessionLifetime)
+	}
+}
+
+func TestSessionLifetimeNotExtended(t *testing.T) {
+	s := &SessionService{store: NewMemoryStore(), policies: map[string]SessionPolicy{
+		ChatTypeP2P: {Lifetime: time.Millisecond * 100, Idle: time.Hour},
+	}}
+	s.SetMsg("om_1", []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}})
+	// 存活期间持续写入也不会延长最长存活时间
+	for i := 0; i < 2; i++ {
+		time.Sleep(time.Millisecond * 40)
+		s.SetSummary("om_1", "summary")
+	}
+	time.Sleep(time.Millisecond * 60)
+	if s.Exists("om_1") {
+		t.Error("Exists() = true after the session lifetime")
+	}
+}
+
+func TestSessionFlag(t *testing.T) {
+	s := &SessionService{store: NewMemoryStore()}
+	s.SetFlag("import:oc_1:ou_1", time.Millisecond*50)
+	if !s.HasFlag("import:oc_1:ou_1") {
+		t.Fatal("HasFlag() = false after SetFlag")
+	}
+	// 标记不是会话，不会被当作过期的话题
+	if s.Exists("import:oc_1:ou_1") || s.Expired("import:oc_1:ou_1") {
+		t.Error("flag should not create a session")
+	}
+	time.Sleep(time.Millisecond * 100)
+	if s.HasFlag("import:oc_1:ou_1") {
+		t.Error("HasFlag() = true after expiration")
+	}
+	s.SetFlag("import:oc_1:ou_1", time.Minute)
+	s.ClearFlag("import:oc_1:ou_1")
+	if s.HasFlag("import:oc_1:ou_1") {
+		t.Error("HasFlag() = true after ClearFlag")
+	}
+}
+
+func TestSessionForkDiverge(t *testing.T) {
+	s := &SessionService{store: NewMemoryStore()}
+	if s.Fork("om_1", "om_2") {
+		t.Error("Fork() = true for a missing session")
+	}
+	temperature := float32(0.5)
+	s.SetMsg("om_1", []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: "system"},
+		{Role: openai.ChatMessageRoleUser, Content: "hi"},
+	})
+	s.SetSummary("om_1", "summary")
+	s.SetSettings("om_1", SessionSettings{Temperature: &temperature})
+	if !s.Fork("om_1", "om_2") {
+		t.Fatal("Fork() = false")
+	}
+	if s.GetSummary("om_2") != "summary" || s.GetSettings("om_2").Temperature == nil {
+		t.Errorf("forked session = %+v, %+v", s.GetSummary("om_2"), s.GetSettings("om_2"))
+	}
+
+	// 分叉后分别追加消息，两个会话互不影响
+	s.SetMsg("om_1", append(s.GetMsg("om_1"), openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "a"}))
+	s.SetMsg("om_2", append(s.GetMsg("om_2"), openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "b"}))
+	s.SetSummary("om_2", "forked summary")
+	if msg := s.GetMsg("om_1"); len(msg) != 3 || msg[2].Content != "a" {
+		t.Errorf("om_1 msg = %+v", msg)
+	}
+	if msg := s.GetMsg("om_2"); len(msg) != 3 || msg[2].Content != "b" {
+		t.Errorf("om_2 msg = %+v", msg)
+	}
+	if s.GetSummary("om_1") != "summary" {
+		t.Errorf("om_1 summary = %q", s.GetSummary("om_1"))
+	}
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+)
+
+const (
+	SessionStoreMemory = "memory"
+	SessionStoreBolt   = "bolt"
+	SessionStoreRedis  = "redis"
+)
+
+const (
+	historyKeyPrefix = "history:"
+	flagKeyPrefix    = "flag:"
+)
+
+// SessionStore 会话的存储后端，SessionService 通过它读写完整的 SessionMeta
+type SessionStore interface {
+	Get(sessionId string) (*SessionMeta, bool)
+	Set(sessionId string, sessionMeta *SessionMeta, expiration time.Duration)
+	Delete(sessionId string)
+	// Lock 锁定会话，保证同一会话的消息串行处理，返回的函数用于解锁
+	Lock(sessionId string) (func(), error)
+	// GetHistory 和 SetHistory 读写用户的话题索引
+	GetHistory(userId string) []HistoryEntry
+	SetHistory(userId string, history []HistoryEntry, expiration time.Duration)
+	// SetFlag、HasFlag 和 DeleteFlag 读写带有效期的临时标记，与会话分开保存
+	SetFlag(key string, expiration time.Duration)
+	HasFlag(key string) bool
+	DeleteFlag(key string)
+}
+
+type SessionStoreConfig struct {
+	Type string
+	Path string
+
+	RedisAddr     string
+	RedisPassword string
+	RedisDB       int
+}
+
+// NewSessionStore 根据配置创建会话存储，未配置时使用内存存储
+func NewSessionStore(config SessionStoreConfig) (SessionStore, error) {
+	switch config.Type {
+	case "", SessionStoreMemory:
+		return NewMemoryStore(), nil
+	case SessionStoreBolt:
+		return NewBoltStore(config.Path)
+	case SessionStoreRedis:
+		return NewRedisStore(config.RedisAddr, config.RedisPassword, config.RedisDB)
+	default:
+		return nil, fmt.Errorf("unknown session store: %v", config.Type)
+	}
+}
+
+type memoryStore struct {
+	cache *cache.Cache
+	localLocker
+}
+
+func NewMemoryStore() SessionStore {
+	// 过期时间由 SessionService 在写入时指定
+	return &memoryStore{cache: cache.New(cache.NoExpiration, time.Hour*1)}
+}
+
+func (s *memoryStore) Get(sessionId string) (*SessionMeta, bool) {
+	sessionContext, ok := s.cache.Get(sessionId)
+	if !ok {
+		return nil, false
+	}
+	return sessionContext.(*SessionMeta), true
+}
+
+func (s *memoryStore) Set(sessionId string, sessionMeta *SessionMeta, expiration time.Duration) {
+	s.cache.Set(sessionId, sessionMeta, expiration)
+}
+
+func (s *memoryStore) Delete(sessionId string) {
+	s.cache.Delete(sessionId)
+}
+
+func (s *memoryStore) GetHistory(userId string) []HistoryEntry {
+	history, ok := s.cache.Get(historyKeyPrefix + userId)
+	if !ok {
+		return nil
+	}
+	return history.([]HistoryEntry)
+}
+
+func (s *memoryStore) SetHistory(userId string, history []HistoryEntry, expiration time.Duration) {
+	s.cache.Set(historyKeyPrefix+userId, history, expiration)
+}
+
+func (s *memoryStore) SetFlag(key string, expiration time.Duration) {
+	s.cache.Set(flagKeyPrefix+key, true, expiration)
+}
+
+func (s *memoryStore) HasFlag(key string) bool {
+	_, ok := s.cache.Get(flagKeyPrefix + key)
+	return ok
+}
+
+func (s *memoryStore) DeleteFlag(key string) {
+	s.cache.Delete(flagKeyPrefix + key)
+}
+
+// localLocker 进程内的会话锁，适用于单实例部署的存储
+type localLocker struct {
+	mu    sync.Mutex
+	locks map[string]*localLock
+}
+
+type localLock struct {
+	mu  sync.Mutex
+	ref int
+}
+
+func (l *localLocker) Lock(sessionId string) (func(), error) {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*localLock)
+	}
+	lock, ok := l.locks[sessionId]
+	if !ok {
+		lock = &localLock{}
+		l.locks[sessionId] = lock
+	}
+	lock.ref++
+	l.mu.Unlock()
+
+	lock.mu.Lock()
+	return func() {
+		lock.mu.Unlock()
+		l.mu.Lock()
+		lock.ref--
+		if lock.ref == 0 {
+			delete(l.locks, sessionId)
+		}
+		l.mu.Unlock()
+	}, nil
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const (
+	SettingModel       = "model"
+	SettingTemperature = "temperature"
+	SettingTopP        = "top_p"
+	SettingMaxTokens   = "max_tokens"
+)
+
+// SettingKeys 支持通过 /set 修改的设置项
+var SettingKeys = []string{SettingModel, SettingTemperature, SettingTopP, SettingMaxTokens}
+
+var modelNamePattern = regexp.MustCompile(`^[\w.\-:/]+$`)
+
+// SessionSettings 会话级别的生成参数，零值表示使用全局配置
+type SessionSettings struct {
+	Model       string   `json:"model,omitempty"`
+	Temperature *float32 `json:"temperature,omitempty"`
+	TopP        *float32 `json:"top_p,omitempty"`
+	MaxTokens   int      `json:"max_tokens,omitempty"`
+	// SystemPrompt 自定义的系统提示词
+	SystemPrompt string `json:"system_prompt,omitempty"`
+	// Mode 通过 /mode 选择的预设
+	Mode string `json:"mode,omitempty"`
+}
+
+// AIMode 回答风格的预设，PromptSuffix 会追加到系统提示词之后
+type AIMode struct {
+	Label        string
+	Temperature  float32
+	TopP         float32
+	PromptSuffix string
+}
+
+// AIModes 回答风格的预设，/mode 使用完整的预设，设置卡片中的创意程度只使用其中的 temperature 和 top_p
+var AIModes = []AIMode{
+	{Label: "严谨", Temperature: 0.1, TopP: 0.5, PromptSuffix: "请给出严谨、准确的回答，不确定的内容请明确说明，不要编造。"},
+	{Label: "简洁", Temperature: 0.3, TopP: 0.8, PromptSuffix: "请用尽量简短的语言回答，直接给出结论，避免铺垫。"},
+	{Label: "标准", Temperature: 0.3, TopP: 1.0},
+	{Label: "发散", Temperature: 0.9, TopP: 1.0, PromptSuffix: "请尽可能发散地思考，从多个不同的角度给出有创意的想法。"},
+}
+
+func AIModeLabels() []string {
+	var labels []string
+	for _, mode := range AIModes {
+		labels = append(labels, mode.Label)
+	}
+	return labels
+}
+
+func aiModeOf(label string) (AIMode, bool) {
+	for _, mode := range AIModes {
+		if mode.Label == label {
+			return mode, true
+		}
+	}
+	return AIMode{}, false
+}
+
+// SetMode 切换预设，同时设置预设的 temperature 和 top_p
+func (s *SessionSettings) SetMode(label string) error {
+	mode, ok := aiModeOf(label)
+	if !ok {
+		return fmt.Errorf("unknown mode: %v, available: %s", label, strings.Join(AIModeLabels(), ", "))
+	}
+	temperature, topP := mode.Temperature, mode.TopP
+	s.Temperature = &temperature
+	s.TopP = &topP
+	s.Mode = mode.Label
+	return nil
+}
+
+// Creativity 返回与当前 temperature 和 top_p 对应的预设
+func (s SessionSettings) Creativity() string {
+	if s.Temperature == nil || s.TopP == nil {
+		return ""
+	}
+	for _, mode := range AIModes {
+		if mode.Temperature == *s.Temperature && mode.TopP == *s.TopP {
+			return mode.Label
+		}
+	}
+	return ""
+}
+
+// SetCreativity 按预设设置 temperature 和 top_p，不追加预设的提示词，因此会取消 /mode 的选择
+func (s *SessionSettings) SetCreativity(label string) error {
+	mode, ok := aiModeOf(label)
+	if !ok {
+		return fmt.Errorf("unknown creativity level: %v, available: %s", label, strings.Join(AIModeLabels(), ", "))
+	}
+	temperature, topP := mode.Temperature, mode.TopP
+	s.Temperature = &temperature
+	s.TopP = &topP
+	s.Mode = ""
+	return nil
+}
+
+// WithModePrompt 将预设的提示词追加到第一条系统消息，不修改原消息
+func (s SessionSettings) WithModePrompt(msgs []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+	mode, ok := aiModeOf(s.Mode)
+	if !ok || mode.PromptSuffix == "" {
+		return msgs
+	}
+	for i, m := range msgs {
+		if m.Role == openai.ChatMessageRoleSystem {
+			result := append([]openai.ChatCompletionMessage(nil), msgs...)
+			result[i].Content = m.Content + "\n" + mode.PromptSuffix
+			return result
+		}
+	}
+	return append([]openai.ChatCompletionMessage{{
+		Role:    openai.ChatMessageRoleSystem,
+		Content: mode.PromptSuffix,
+	}}, msgs...)
+}
+
+// Set 校验并修改一项设置，value 为 default 时恢复全局配置
+func (s *SessionSettings) Set(key, value string) error {
+	reset := value == "default"
+	switch key {
+	case SettingModel:
+		if reset {
+			s.Model = ""
+			return nil
+		}
+		if !modelNamePattern.MatchString(value) {
+			return fmt.Errorf("invalid model: %v", value)
+		}
+		s.Model = value
+	case SettingTemperature:
+		if reset {
+			s.Temperature = nil
+			s.Mode = ""
+			return nil
+		}
+		v, err := parseFloatIn(value, 0, 2)
+		if err != nil {
+			return err
+		}
+		s.Temperature = &v
+		s.Mode = ""
+	case SettingTopP:
+		if reset {
+			s.TopP = nil
+			s.Mode = ""
+			return nil
+		}
+		v, err := parseFloatIn(value, 0, 1)
+		if err != nil {
+			return err
+		}
+		s.TopP = &v
+		s.Mode = ""
+	case SettingMaxTokens:
+		if reset {
+			s.MaxTokens = 0
+			return nil
+		}
+		v, err := strconv.Atoi(value)
+		if err != nil || v <= 0 {
+			return fmt.Errorf("invalid max_tokens: %v", value)
+		}
+		s.MaxTokens = v
+	default:
+		return fmt.Errorf("unknown setting: %v, available: %s", key, strings.Join(SettingKeys, ", "))
+	}
+	return nil
+}
+
+func parseFloatIn(value string, min, max float32) (float32, error) {
+	f, err := strconv.ParseFloat(value, 32)
+	if err != nil || float32(f) < min || float32(f) > max {
+		return 0, fmt.Errorf("invalid value: %v, should be between %v and %v", value, min, max)
+	}
+	return float32(f), nil
+}
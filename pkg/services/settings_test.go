@@ -0,0 +1,93 @@
+package services
+
+import (
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestSetMode(t *testing.T) {
+	var settings SessionSettings
+	if err := settings.SetMode("严谨"); err != nil {
+		t.Fatal(err)
+	}
+	if settings.Mode != "严谨" || *settings.Temperature != 0.1 || *settings.TopP != 0.5 {
+		t.Errorf("SetMode() = %+v", settings)
+	}
+	if err := settings.SetMode("unknown"); err == nil {
+		t.Error("SetMode() want error for unknown mode")
+	}
+}
+
+func TestWithModePrompt(t *testing.T) {
+	msgs := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: "system"},
+		{Role: openai.ChatMessageRoleUser, Content: "hi"},
+	}
+	got := SessionSettings{Mode: "简洁"}.WithModePrompt(msgs)
+	if got[0].Content == "system" || msgs[0].Content != "system" {
+		t.Errorf("WithModePrompt() = %q, original = %q", got[0].Content, msgs[0].Content)
+	}
+	if got := (SessionSettings{Mode: "标准"}).WithModePrompt(msgs); got[0].Content != "system" {
+		t.Errorf("WithModePrompt() without suffix = %q", got[0].Content)
+	}
+	got = SessionSettings{Mode: "发散"}.WithModePrompt(msgs[1:])
+	if len(got) != 2 || got[0].Role != openai.ChatMessageRoleSystem {
+		t.Errorf("WithModePrompt() without system message = %+v", got)
+	}
+}
+
+func TestCheckSettings(t *testing.T) {
+	llm := NewFakeProvider()
+	llm.Model, llm.MaxTokens = "moonshot-v1-32k", 2000
+	tests := []struct {
+		name     string
+		settings SessionSettings
+		wantErr  bool
+	}{
+		{name: "默认设置", settings: SessionSettings{}},
+		{name: "max_tokens 小于上下文窗口", settings: SessionSettings{MaxTokens: 32767}},
+		{name: "max_tokens 等于上下文窗口", settings: SessionSettings{MaxTokens: 32768}, wantErr: true},
+		{name: "切换到更小的模型", settings: SessionSettings{Model: "moonshot-v1-8k", MaxTokens: 16000}, wantErr: true},
+		{name: "切换模型", settings: SessionSettings{Model: "gpt-4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckSettings(llm, tt.settings); (err != nil) != tt.wantErr {
+				t.Errorf("CheckSettings() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+	llm.MaxTokens = 10000
+	if err := CheckSettings(llm, SessionSettings{Model: "moonshot-v1-8k"}); err == nil {
+		t.Error("CheckSettings() want error when the default max_tokens exceeds the new model's window")
+	}
+}
+
+func TestCreativityClearsMode(t *testing.T) {
+	var settings SessionSettings
+	if err := settings.SetMode("严谨"); err != nil {
+		t.Fatal(err)
+	}
+	if got := settings.Creativity(); got != "严谨" {
+		t.Errorf("Creativity() = %q, want 严谨", got)
+	}
+	if err := settings.SetCreativity("标准"); err != nil {
+		t.Fatal(err)
+	}
+	if settings.Mode != "" || *settings.Temperature != 0.3 || *settings.TopP != 1.0 || settings.Creativity() != "标准" {
+		t.Errorf("SetCreativity() = %+v", settings)
+	}
+	for _, key := range []string{SettingTemperature, SettingTopP} {
+		settings.SetMode("发散")
+		if err := settings.Set(key, "0.5"); err != nil {
+			t.Fatal(err)
+		}
+		if settings.Mode != "" {
+			t.Errorf("Set(%s) did not clear Mode", key)
+		}
+	}
+	if err := settings.SetCreativity("unknown"); err == nil {
+		t.Error("SetCreativity() want error for unknown level")
+	}
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// 为摘要预留的 token 数
+const summaryMaxTokens = 800
+
+const summaryPrompt = `你是一个对话摘要助手。请把已有摘要和新增的对话合并为一份新的摘要，
+保留关键事实、结论、用户的偏好和已经做出的决定，省略寒暄和重复内容。
+直接输出摘要正文，使用与对话相同的语言，不超过 500 字。`
+
+// SummaryMessage 将滚动摘要包装成 system 消息
+func SummaryMessage(summary string) openai.ChatCompletionMessage {
+	return openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleSystem,
+		Content: "以下是之前对话的摘要：\n" + summary,
+		Name:    "Kimi",
+	}
+}
+
+// WithSummary 将摘要插入到开头的 system 消息之后
+func WithSummary(msgs []openai.ChatCompletionMessage, summary string) []openai.ChatCompletionMessage {
+	if summary == "" {
+		return msgs
+	}
+	i := 0
+	for i < len(msgs) && msgs[i].Role == openai.ChatMessageRoleSystem {
+		i++
+	}
+	result := make([]openai.ChatCompletionMessage, 0, len(msgs)+1)
+	result = append(result, msgs[:i]...)
+	result = append(result, SummaryMessage(summary))
+	return append(result, msgs[i:]...)
+}
+
+// Summarize 将被裁剪掉的轮次合并进已有摘要，内容超过模型窗口时分批合并
+func Summarize(ctx context.Context, llm LLMProvider, summary string, evicted []openai.ChatCompletionMessage, model string) (string, error) {
+	for _, chunk := range summaryChunks(evicted, summaryChunkTokens(model)) {
+		var err error
+		if summary, err = summarizeChunk(ctx, llm, summary, chunk, model); err != nil {
+			return "", err
+		}
+	}
+	return summary, nil
+}
+
+func summarizeChunk(ctx context.Context, llm LLMProvider, summary string, evicted []openai.ChatCompletionMessage, model string) (string, error) {
+	var conversation strings.Builder
+	for _, m := range evicted {
+		role := "用户"
+		if m.Role == openai.ChatMessageRoleAssistant {
+			role = "助手"
+		}
+		fmt.Fprintf(&conversation, "%s: %s\n", role, strings.TrimSpace(m.Content))
+	}
+	if summary == "" {
+		summary = "无"
+	}
+	resp, err := llm.Completions(ctx, []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: summaryPrompt},
+		{Role: openai.ChatMessageRoleUser, Content: fmt.Sprintf("已有摘要：\n%s\n\n新增对话：\n%s", summary, conversation.String())},
+	}, SessionSettings{Model: model, MaxTokens: summaryMaxTokens})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(resp.Content), nil
+}
+
+// summaryChunkTokens 每次摘要请求中对话内容可用的 token 数，需要预留提示词、已有摘要和输出
+func summaryChunkTokens(model string) int {
+	return max(ContextWindow(model)-3*summaryMaxTokens, summaryMaxTokens)
+}
+
+// summaryChunks 按 token 数将消息分批，单条超过限制的消息截断到限制以内
+func summaryChunks(msgs []openai.ChatCompletionMessage, limit int) [][]openai.ChatCompletionMessage {
+	var chunks [][]openai.ChatCompletionMessage
+	var chunk []openai.ChatCompletionMessage
+	total := 0
+	for _, m := range msgs {
+		length := CalculateTokenLength(m) + tokensPerMessage
+		if length > limit {
+			runes := []rune(m.Content)
+			m.Content = string(runes[:len(runes)*limit/length*9/10]) + "…"
+			length = CalculateTokenLength(m) + tokensPerMessage
+		}
+		if len(chunk) > 0 && total+length > limit {
+			chunks = append(chunks, chunk)
+			chunk, total = nil, 0
+		}
+		chunk = append(chunk, m)
+		total += length
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+// CompactContext 将上下文裁剪到会话设置对应的预算内，被裁剪的轮次合并进滚动摘要。
+// 返回的消息不包含摘要，请求时通过 WithSummary 拼接。
+// 摘要失败时返回裁剪后的消息、原摘要和错误，裁剪后的消息只能用于本次请求，不能写回会话
+func CompactContext(ctx context.Context, llm LLMProvider, msgs []openai.ChatCompletionMessage, summary string, settings SessionSettings) ([]openai.ChatCompletionMessage, string, error) {
+	budget := ContextBudgetOf(llm, settings)
+	reserve := 0
+	if summary != "" {
+		reserve = CalculateTokenLength(SummaryMessage(summary)) + tokensPerMessage
+	}
+	kept, evicted := FitContext(msgs, budget-reserve)
+	if len(evicted) == 0 {
+		return kept, summary, nil
+	}
+	// 需要更新摘要时，按摘要的最大长度预留空间
+	kept, evicted = FitContext(msgs, budget-summaryMaxTokens)
+	newSummary, err := Summarize(ctx, llm, summary, evicted, llm.ModelOf(settings))
+	if err != nil {
+		return kept, summary, err
+	}
+	return kept, newSummary, nil
+}
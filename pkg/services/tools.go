@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"go.uber.org/zap"
+)
+
+// maxToolRounds 一次回答中最多调用工具的轮数，超过后要求模型直接回答
+const maxToolRounds = 5
+
+// ToolChoiceNone 要求模型不调用工具、直接回答
+const ToolChoiceNone = "none"
+
+// ToolHandler 执行工具调用，arguments 为模型生成的 JSON 参数，返回交给模型的结果
+type ToolHandler func(ctx context.Context, arguments string) (string, error)
+
+// Tool 可以被模型调用的工具
+type Tool struct {
+	Name        string
+	Description string
+	// Parameters 参数的 JSON Schema
+	Parameters json.RawMessage
+	Handler    ToolHandler
+}
+
+var toolNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// ToolRegistry 按注册顺序保存工具，nil 表示不使用工具
+type ToolRegistry struct {
+	tools  map[string]Tool
+	names  []string
+	logger *zap.Logger
+}
+
+func NewToolRegistry(logger *zap.Logger) *ToolRegistry {
+	return &ToolRegistry{tools: map[string]Tool{}, logger: logger}
+}
+
+func (r *ToolRegistry) Register(tool Tool) error {
+	if !toolNamePattern.MatchString(tool.Name) {
+		return fmt.Errorf("invalid tool name: %q", tool.Name)
+	}
+	if _, ok := r.tools[tool.Name]; ok {
+		return fmt.Errorf("duplicate tool: %v", tool.Name)
+	}
+	if tool.Handler == nil {
+		return fmt.Errorf("tool %s: handler is required", tool.Name)
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(tool.Parameters, &schema); err != nil {
+		return fmt.Errorf("tool %s: invalid parameters schema: %w", tool.Name, err)
+	}
+	r.tools[tool.Name] = tool
+	r.names = append(r.names, tool.Name)
+	return nil
+}
+
+func (r *ToolRegistry) Len() int {
+	if r == nil {
+		return 0
+	}
+	return len(r.names)
+}
+
+// Names 返回已注册的工具名
+func (r *ToolRegistry) Names() []string {
+	if r == nil {
+		return nil
+	}
+	return append([]string(nil), r.names...)
+}
+
+// Definitions 返回请求中的 tools 参数
+func (r *ToolRegistry) Definitions() []openai.Tool {
+	tools := make([]openai.Tool, 0, r.Len())
+	for _, name := range r.Names() {
+		tool := r.tools[name]
+		tools = append(tools, openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+	return tools
+}
+
+// Call 执行一次工具调用，出错时把错误信息作为结果交给模型
+func (r *ToolRegistry) Call(ctx context.Context, call openai.ToolCall) openai.ChatCompletionMessage {
+	result := openai.ChatCompletionMessage{
+		Role:       openai.ChatMessageRoleTool,
+		Name:       call.Function.Name,
+		ToolCallID: call.ID,
+	}
+	tool, ok := r.tools[call.Function.Name]
+	if !ok {
+		result.Content = fmt.Sprintf("error: unknown tool %s", call.Function.Name)
+		return result
+	}
+	start := time.Now()
+	content, err := tool.Handler(ctx, call.Function.Arguments)
+	if err != nil {
+		content = fmt.Sprintf("error: %v", err)
+	}
+	if r.logger != nil {
+		r.logger.Info("tool call", zap.String("name", tool.Name), zap.String("arguments", call.Function.Arguments),
+			zap.Duration("duration", time.Since(start)), zap.Error(err))
+	}
+	result.Content = content
+	return result
+}
+
+// StreamChat 流式请求回答，模型调用工具时执行工具、将结果加入上下文后继续请求，
+// 所有轮次的回答都会写入 responseStream。工具调用的过程只在本次请求中使用，不写入会话
+func (r *ToolRegistry) StreamChat(ctx context.Context, llm LLMProvider, msgs []openai.ChatCompletionMessage,
+	settings SessionSettings, responseStream chan<- string) (openai.FinishReason, error) {
+	if r.Len() == 0 {
+		return llm.StreamChat(ctx, msgs, settings, responseStream)
+	}
+	defer close(responseStream)
+	msgs = append([]openai.ChatCompletionMessage(nil), msgs...)
+	for round := 0; ; round++ {
+		// 超过轮数后仍然带上工具定义，否则上下文中的工具调用会被拒绝，改为禁止调用工具
+		toolChoice := ""
+		if round >= maxToolRounds {
+			toolChoice = ToolChoiceNone
+		}
+		stream := make(chan string)
+		done := make(chan struct{})
+		var finishReason openai.FinishReason
+		var toolCalls []openai.ToolCall
+		var err error
+		go func() {
+			defer close(done)
+			finishReason, toolCalls, err = llm.StreamChatTools(ctx, msgs, settings, r.Definitions(), toolChoice, stream)
+		}()
+		content := ""
+		for chunk := range stream {
+			content += chunk
+			responseStream <- chunk
+		}
+		<-done
+		if err != nil || len(toolCalls) == 0 {
+			return finishReason, err
+		}
+		msgs = append(msgs, openai.ChatCompletionMessage{
+			Role:      openai.ChatMessageRoleAssistant,
+			Content:   content,
+			ToolCalls: toolCalls,
+		})
+		for _, call := range toolCalls {
+			msgs = append(msgs, r.Call(ctx, call))
+		}
+	}
+}
+
+// mergeToolCallDeltas 将流式返回的 tool_calls 片段按 index 合并
+func mergeToolCallDeltas(calls []openai.ToolCall, deltas []openai.ToolCall) []openai.ToolCall {
+	for _, delta := range deltas {
+		i := len(calls) - 1
+		if delta.Index != nil {
+			i = *delta.Index
+		} else if delta.ID != "" || i < 0 {
+			i = len(calls)
+		}
+		for len(calls) <= i {
+			calls = append(calls, openai.ToolCall{Type: openai.ToolTypeFunction})
+		}
+		call := &calls[i]
+		if delta.ID != "" {
+			call.ID = delta.ID
+		}
+		if delta.Type != "" {
+			call.Type = delta.Type
+		}
+		call.Function.Name += delta.Function.Name
+		call.Function.Arguments += delta.Function.Arguments
+	}
+	return calls
+}
@@ -0,0 +1,205 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestCalculate(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       float64
+		wantErr    bool
+	}{
+		{expression: "1 + 2 * 3", want: 7},
+		{expression: "(1 + 2) * 3", want: 9},
+		{expression: "2 ^ 3 ^ 2", want: 512},
+		{expression: "-2 ^ 2", want: -4},
+		{expression: "2 ^ -1", want: 0.5},
+		{expression: "10 % 4 - 7 / 2", want: -1.5},
+		{expression: "0.1 + 0.2 * 10", want: 2.1},
+		{expression: "1 / 0", wantErr: true},
+		{expression: "1 +", wantErr: true},
+		{expression: "(1 + 2", wantErr: true},
+		{expression: "2 x 3", wantErr: true},
+		{expression: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := Calculate(tt.expression)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Calculate(%q) error = %v, wantErr %v", tt.expression, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("Calculate(%q) = %v, want %v", tt.expression, got, tt.want)
+		}
+	}
+}
+
+func TestToolRegistryRegister(t *testing.T) {
+	handler := func(ctx context.Context, arguments string) (string, error) { return "", nil }
+	schema := json.RawMessage(`{"type":"object"}`)
+	tests := []struct {
+		name    string
+		tool    Tool
+		wantErr bool
+	}{
+		{name: "正常", tool: Tool{Name: "echo", Parameters: schema, Handler: handler}},
+		{name: "重复", tool: Tool{Name: ToolCalculator, Parameters: schema, Handler: handler}, wantErr: true},
+		{name: "名称不合法", tool: Tool{Name: "查询", Parameters: schema, Handler: handler}, wantErr: true},
+		{name: "缺少 handler", tool: Tool{Name: "empty", Parameters: schema}, wantErr: true},
+		{name: "schema 不合法", tool: Tool{Name: "bad", Parameters: json.RawMessage(`{`), Handler: handler}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := NewToolRegistry(nil)
+			if err := registry.Register(NewCalculatorTool()); err != nil {
+				t.Fatal(err)
+			}
+			if err := registry.Register(tt.tool); (err != nil) != tt.wantErr {
+				t.Errorf("Register() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCurrentTimeTool(t *testing.T) {
+	tool, err := NewCurrentTimeTool("Asia/Shanghai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		arguments string
+		want      string
+		wantErr   bool
+	}{
+		{arguments: `{}`, want: `"timezone":"Asia/Shanghai"`},
+		{arguments: `{"timezone":"America/New_York"}`, want: `"timezone":"America/New_York"`},
+		{arguments: `{"timezone":"Mars/Base"}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := tool.Handler(context.Background(), tt.arguments)
+		if (err != nil) != tt.wantErr || !strings.Contains(got, tt.want) {
+			t.Errorf("current_time(%s) = %v, %v, want %v", tt.arguments, got, err, tt.want)
+		}
+	}
+	if _, err := NewCurrentTimeTool("Mars/Base"); err == nil {
+		t.Error("NewCurrentTimeTool() with unknown timezone should fail")
+	}
+}
+
+func calculatorCall(id, expression string) openai.ToolCall {
+	arguments, _ := json.Marshal(map[string]string{"expression": expression})
+	return openai.ToolCall{
+		ID:       id,
+		Type:     openai.ToolTypeFunction,
+		Function: openai.FunctionCall{Name: ToolCalculator, Arguments: string(arguments)},
+	}
+}
+
+func TestToolRegistryStreamChat(t *testing.T) {
+	registry := NewToolRegistry(nil)
+	if err := registry.Register(NewCalculatorTool()); err != nil {
+		t.Fatal(err)
+	}
+	llm := NewFakeProvider("结果是 42")
+	llm.ToolCalls = [][]openai.ToolCall{
+		{calculatorCall("call-1", "6 * 7"), {ID: "call-2", Function: openai.FunctionCall{Name: "unknown", Arguments: "{}"}}},
+	}
+	stream := make(chan string)
+	done := make(chan struct{})
+	var answer strings.Builder
+	go func() {
+		defer close(done)
+		for chunk := range stream {
+			answer.WriteString(chunk)
+		}
+	}()
+	_, err := registry.StreamChat(context.Background(), llm, []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleUser, Content: "6 乘 7 等于多少"},
+	}, SessionSettings{}, stream)
+	<-done
+	if err != nil || answer.String() != "结果是 42" {
+		t.Fatalf("StreamChat() = %q, %v", answer.String(), err)
+	}
+	requests := llm.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("requests = %d, want 2", len(requests))
+	}
+	// 第二次请求带上模型的工具调用和工具结果
+	second := requests[1]
+	if len(second) != 4 || len(second[1].ToolCalls) != 2 {
+		t.Fatalf("second request = %+v", second)
+	}
+	if second[2].Role != openai.ChatMessageRoleTool || second[2].ToolCallID != "call-1" || second[2].Content != "42" {
+		t.Errorf("calculator result = %+v", second[2])
+	}
+	if !strings.HasPrefix(second[3].Content, "error: unknown tool") {
+		t.Errorf("unknown tool result = %+v", second[3])
+	}
+}
+
+func TestToolRegistryMaxRounds(t *testing.T) {
+	registry := NewToolRegistry(nil)
+	if err := registry.Register(NewCalculatorTool()); err != nil {
+		t.Fatal(err)
+	}
+	llm := NewFakeProvider("done")
+	for i := 0; i < maxToolRounds+3; i++ {
+		llm.ToolCalls = append(llm.ToolCalls, []openai.ToolCall{calculatorCall("call", "1 + 1")})
+	}
+	answer, err := streamAll(t, toolProvider{llm, registry}, SessionSettings{})
+	if err != nil || answer != "done" {
+		t.Fatalf("StreamChat() = %q, %v", answer, err)
+	}
+	if got := len(llm.Requests()); got != maxToolRounds+1 {
+		t.Errorf("requests = %d, want %d", got, maxToolRounds+1)
+	}
+	// 最后一轮仍然带上工具定义，但禁止调用
+	reqs := llm.ToolRequests()
+	if len(reqs) != maxToolRounds+1 {
+		t.Fatalf("tool requests = %+v", reqs)
+	}
+	for i, req := range reqs {
+		want := ""
+		if i == maxToolRounds {
+			want = ToolChoiceNone
+		}
+		if req.Tools == 0 || req.ToolChoice != want {
+			t.Errorf("tool request %d = %+v, want tool_choice %q", i, req, want)
+		}
+	}
+}
+
+// toolProvider 通过 ToolRegistry.StreamChat 请求回答，方便复用 streamAll
+type toolProvider struct {
+	*FakeProvider
+	registry *ToolRegistry
+}
+
+func (p toolProvider) StreamChat(ctx context.Context, msgs []openai.ChatCompletionMessage, settings SessionSettings, responseStream chan<- string) (openai.FinishReason, error) {
+	return p.registry.StreamChat(ctx, p.FakeProvider, msgs, settings, responseStream)
+}
+
+func TestMergeToolCallDeltas(t *testing.T) {
+	index := func(i int) *int { return &i }
+	calls := mergeToolCallDeltas(nil, []openai.ToolCall{
+		{Index: index(0), ID: "call-1", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "calculator"}},
+		{Index: index(0), Function: openai.FunctionCall{Arguments: `{"expression":`}},
+		{Index: index(1), ID: "call-2", Function: openai.FunctionCall{Name: "current_time", Arguments: `{}`}},
+		{Index: index(0), Function: openai.FunctionCall{Arguments: `"1+1"}`}},
+	})
+	if len(calls) != 2 {
+		t.Fatalf("calls = %+v", calls)
+	}
+	if calls[0].ID != "call-1" || calls[0].Function.Arguments != `{"expression":"1+1"}` || calls[0].Index != nil {
+		t.Errorf("calls[0] = %+v", calls[0])
+	}
+	if calls[1].ID != "call-2" || calls[1].Function.Name != "current_time" || calls[1].Type != openai.ToolTypeFunction {
+		t.Errorf("calls[1] = %+v", calls[1])
+	}
+}
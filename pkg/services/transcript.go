@@ -0,0 +1,125 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const TranscriptVersion = 1
+
+// Transcript 导出的对话记录
+type Transcript struct {
+	Version    int                 `json:"version"`
+	SessionId  string              `json:"session_id"`
+	ExportedAt time.Time           `json:"exported_at"`
+	Summary    string              `json:"summary,omitempty"`
+	Messages   []TranscriptMessage `json:"messages"`
+}
+
+type TranscriptMessage struct {
+	Role        string `json:"role"`
+	Name        string `json:"name,omitempty"`
+	DisplayName string `json:"display_name,omitempty"`
+	Content     string `json:"content"`
+}
+
+// NewTranscript 根据会话消息生成对话记录，displayNames 为 name 到展示名的映射
+func NewTranscript(sessionId string, msgs []openai.ChatCompletionMessage, summary string, displayNames map[string]string) *Transcript {
+	t := &Transcript{
+		Version:    TranscriptVersion,
+		SessionId:  sessionId,
+		ExportedAt: time.Now(),
+		Summary:    summary,
+	}
+	for _, m := range msgs {
+		t.Messages = append(t.Messages, TranscriptMessage{
+			Role:        m.Role,
+			Name:        m.Name,
+			DisplayName: displayNames[m.Name],
+			Content:     m.Content,
+		})
+	}
+	return t
+}
+
+func (t *Transcript) JSON() ([]byte, error) {
+	return json.MarshalIndent(t, "", "  ")
+}
+
+func (t *Transcript) Markdown() string {
+	var b strings.Builder
+	b.WriteString("# 对话记录\n\n")
+	fmt.Fprintf(&b, "导出时间：%s\n\n", t.ExportedAt.Format(time.DateTime))
+	if t.Summary != "" {
+		fmt.Fprintf(&b, "> 更早的对话摘要：%s\n\n", t.Summary)
+	}
+	for _, m := range t.Messages {
+		name := m.DisplayName
+		if name == "" {
+			name = m.Name
+		}
+		switch m.Role {
+		case openai.ChatMessageRoleSystem:
+			// 系统提示词和文件内容可能很长，只保留开头
+			content := []rune(m.Content)
+			if len(content) > 500 {
+				content = append(content[:500], []rune("…")...)
+			}
+			fmt.Fprintf(&b, "## ⚙️ 系统\n\n```\n%s\n```\n\n", string(content))
+		case openai.ChatMessageRoleAssistant:
+			fmt.Fprintf(&b, "## 🤖 %s\n\n%s\n\n", name, m.Content)
+		default:
+			fmt.Fprintf(&b, "## 👤 %s\n\n%s\n\n", name, m.Content)
+		}
+	}
+	return b.String()
+}
+
+// ParseTranscript 解析并校验 /export json 导出的对话记录
+func ParseTranscript(data []byte) (*Transcript, error) {
+	var t Transcript
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("invalid transcript json: %w", err)
+	}
+	if t.Version != TranscriptVersion {
+		return nil, fmt.Errorf("unsupported transcript version: %v", t.Version)
+	}
+	if len(t.Messages) == 0 {
+		return nil, errors.New("transcript has no messages")
+	}
+	hasUser := false
+	for i, m := range t.Messages {
+		switch m.Role {
+		case openai.ChatMessageRoleSystem:
+		case openai.ChatMessageRoleUser, openai.ChatMessageRoleAssistant:
+			if strings.TrimSpace(m.Content) == "" {
+				return nil, fmt.Errorf("message %d has empty content", i)
+			}
+			hasUser = hasUser || m.Role == openai.ChatMessageRoleUser
+		default:
+			return nil, fmt.Errorf("message %d has unknown role: %v", i, m.Role)
+		}
+	}
+	if !hasUser {
+		return nil, errors.New("transcript has no user messages")
+	}
+	return &t, nil
+}
+
+// ChatMessages 转换为会话消息
+func (t *Transcript) ChatMessages() []openai.ChatCompletionMessage {
+	msgs := make([]openai.ChatCompletionMessage, 0, len(t.Messages))
+	for _, m := range t.Messages {
+		msgs = append(msgs, openai.ChatCompletionMessage{
+			Role:    m.Role,
+			Content: m.Content,
+			Name:    m.Name,
+		})
+	}
+	return msgs
+}
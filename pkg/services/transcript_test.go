@@ -0,0 +1,85 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestParseTranscript(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{name: "正常", data: `{"version":1,"messages":[{"role":"system","content":""},{"role":"user","content":"你好"},{"role":"assistant","content":"你好！"}]}`},
+		{name: "不是 json", data: `not json`, wantErr: "invalid transcript json"},
+		{name: "版本不支持", data: `{"version":2,"messages":[{"role":"user","content":"你好"}]}`, wantErr: "unsupported transcript version"},
+		{name: "缺少版本", data: `{"messages":[{"role":"user","content":"你好"}]}`, wantErr: "unsupported transcript version"},
+		{name: "没有消息", data: `{"version":1,"messages":[]}`, wantErr: "no messages"},
+		{name: "未知角色", data: `{"version":1,"messages":[{"role":"user","content":"你好"},{"role":"tool","content":"42"}]}`, wantErr: "unknown role"},
+		{name: "内容为空", data: `{"version":1,"messages":[{"role":"user","content":"你好"},{"role":"assistant","content":"  "}]}`, wantErr: "empty content"},
+		{name: "没有用户消息", data: `{"version":1,"messages":[{"role":"system","content":"system"},{"role":"assistant","content":"你好"}]}`, wantErr: "no user messages"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseTranscript([]byte(tt.data))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ParseTranscript() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseTranscript() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTranscriptRoundTrip(t *testing.T) {
+	msgs := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: "system", Name: "Kimi"},
+		{Role: openai.ChatMessageRoleUser, Content: "你好", Name: "ou_1"},
+		{Role: openai.ChatMessageRoleAssistant, Content: "你好！有什么可以帮你？", Name: "Kimi"},
+	}
+	transcript := NewTranscript("om_1", msgs, "更早的摘要", map[string]string{"ou_1": "张三"})
+	data, err := transcript.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, err := ParseTranscript(data)
+	if err != nil {
+		t.Fatalf("ParseTranscript() error = %v", err)
+	}
+	if imported.SessionId != "om_1" || imported.Summary != "更早的摘要" || imported.Messages[1].DisplayName != "张三" {
+		t.Errorf("imported = %+v", imported)
+	}
+	got := imported.ChatMessages()
+	if len(got) != len(msgs) {
+		t.Fatalf("ChatMessages() = %+v", got)
+	}
+	for i := range msgs {
+		if got[i].Role != msgs[i].Role || got[i].Content != msgs[i].Content || got[i].Name != msgs[i].Name {
+			t.Errorf("ChatMessages()[%d] = %+v, want %+v", i, got[i], msgs[i])
+		}
+	}
+}
+
+func TestTranscriptMarkdown(t *testing.T) {
+	transcript := NewTranscript("om_1", []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: strings.Repeat("长", 600)},
+		{Role: openai.ChatMessageRoleUser, Content: "你好", Name: "ou_1"},
+		{Role: openai.ChatMessageRoleAssistant, Content: "你好！", Name: "Kimi"},
+	}, "", map[string]string{"ou_1": "张三"})
+	md := transcript.Markdown()
+	for _, want := range []string{"## 👤 张三\n\n你好", "## 🤖 Kimi\n\n你好！", strings.Repeat("长", 500) + "…"} {
+		if !strings.Contains(md, want) {
+			t.Errorf("Markdown() missing %q:\n%s", want, md)
+		}
+	}
+	if strings.Contains(md, strings.Repeat("长", 501)) {
+		t.Error("Markdown() should truncate long system messages")
+	}
+}
@@ -83,3 +83,41 @@ func MatchReadFile(input string) (bool, string, string) {
 	}
 	return false, "", ""
 }
+
+func MatchExport(input string) (bool, string) {
+	pattern := `^/export(?:\s+(md|json))?\s*$`
+	re := regexp.MustCompile(pattern)
+	matches := re.FindStringSubmatch(strings.TrimSpace(input))
+
+	if len(matches) > 1 {
+		format := matches[1]
+		if format == "" {
+			format = "md"
+		}
+		return true, format
+	}
+	return false, ""
+}
+
+func MatchSet(input string) (bool, string, string) {
+	pattern := `^/set\s+(\S+)\s+(\S+)$`
+	re := regexp.MustCompile(pattern)
+	matches := re.FindStringSubmatch(strings.TrimSpace(input))
+
+	if len(matches) > 2 {
+		return true, matches[1], matches[2]
+	}
+	return false, "", ""
+}
+
+// MatchRetry 匹配 /retry 或 重试，可选参数为本次使用的 temperature
+func MatchRetry(input string) (bool, string) {
+	pattern := `^(?:/retry|重试)(?:\s+(\S+))?\s*$`
+	re := regexp.MustCompile(pattern)
+	matches := re.FindStringSubmatch(strings.TrimSpace(input))
+
+	if len(matches) > 1 {
+		return true, matches[1]
+	}
+	return false, ""
+}
@@ -107,3 +107,74 @@ func TestEitherTrimEqual(t *testing.T) {
 		})
 	}
 }
+
+func TestMatchExport(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		want   bool
+		format string
+	}{
+		{name: "default format", input: "/export", want: true, format: "md"},
+		{name: "json", input: " /export json ", want: true, format: "json"},
+		{name: "unknown format", input: "/export pdf", want: false, format: ""},
+		{name: "not a command", input: "please /export", want: false, format: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, format := MatchExport(tt.input)
+			if got != tt.want {
+				t.Errorf("MatchExport() got = %v, want %v", got, tt.want)
+			}
+			if format != tt.format {
+				t.Errorf("MatchExport() format = %v, want %v", format, tt.format)
+			}
+		})
+	}
+}
+
+func TestMatchSet(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  bool
+		key   string
+		value string
+	}{
+		{name: "set model", input: "/set model moonshot-v1-8k", want: true, key: "model", value: "moonshot-v1-8k"},
+		{name: "set temperature", input: " /set temperature 0.3 ", want: true, key: "temperature", value: "0.3"},
+		{name: "missing value", input: "/set model", want: false},
+		{name: "settings", input: "/settings", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, key, value := MatchSet(tt.input)
+			if got != tt.want || key != tt.key || value != tt.value {
+				t.Errorf("MatchSet() got = %v, %v, %v, want %v, %v, %v", got, key, value, tt.want, tt.key, tt.value)
+			}
+		})
+	}
+}
+
+func TestMatchRetry(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		want        bool
+		temperature string
+	}{
+		{name: "retry", input: "/retry", want: true},
+		{name: "retry with temperature", input: " /retry 0.8 ", want: true, temperature: "0.8"},
+		{name: "chinese", input: "重试", want: true},
+		{name: "retry with text", input: "/retry 0.8 again", want: false},
+		{name: "other", input: "/retrying", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, temperature := MatchRetry(tt.input)
+			if got != tt.want || temperature != tt.temperature {
+				t.Errorf("MatchRetry() got = %v, %v, want %v, %v", got, temperature, tt.want, tt.temperature)
+			}
+		})
+	}
+}